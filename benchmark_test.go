@@ -50,6 +50,50 @@ func BenchmarkPageWebkit(b *testing.B) {
 	}
 }
 
+func BenchmarkServedPageChromium(b *testing.B) {
+	base := setupServedBenchmark(b)
+
+	// warmup
+	checkPage(b, playwrightcigo.Chromium, base)
+
+	for b.Loop() {
+		checkPage(b, playwrightcigo.Chromium, base)
+	}
+}
+
+func BenchmarkServedPageFirefox(b *testing.B) {
+	base := setupServedBenchmark(b)
+
+	// warmup
+	checkPage(b, playwrightcigo.Firefox, base)
+
+	for b.Loop() {
+		checkPage(b, playwrightcigo.Firefox, base)
+	}
+}
+
+func BenchmarkServedPageWebkit(b *testing.B) {
+	base := setupServedBenchmark(b)
+
+	// warmup
+	checkPage(b, playwrightcigo.Webkit, base)
+
+	for b.Loop() {
+		checkPage(b, playwrightcigo.Webkit, base)
+	}
+}
+
+// setupServedBenchmark serves the page from the process, see Serve, instead of
+// a port of the host.
+func setupServedBenchmark(b *testing.B) string {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("Hello World!"))
+	})
+
+	return playwrightcigo.Serve(b, mux, playwrightcigo.WithTimeout(10*time.Minute))
+}
+
 func setupBenchmark(b *testing.B) (func(), string) {
 	if err := playwrightcigo.Install(playwrightcigo.WithTimeout(10 * time.Minute)); err != nil {
 		b.Fatalf("could not install playwright: %v", err)
@@ -3,69 +3,631 @@ package playwrightcigo
 import (
 	"context"
 	"fmt"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/mxschmitt/playwright-go"
 )
 
-var mutexBrowser sync.Mutex
+// portPoolBase is the first container port of the pool the servers not
+// listening on the port of their BrowserSpec take their port from.
+// maxPortPool bounds the size of the pool, so that ports above it stay free
+// for RegisterBrowser.
+const (
+	portPoolBase = 1024 + 16
+	maxPortPool  = 256
+)
 
 type browser struct {
+	session      *Session
+	key          string
+	spec         BrowserSpec
 	instanceOf   string
 	instancePort int
+	options      LaunchOptions
 	uri          string
-	cancel       context.CancelFunc
+	stop         func()
 	count        int
+
+	// idle stops the server once it has not been used for a while.
+	idle *time.Timer
+
+	// restarts counts the relaunches of the server, and so identifies its
+	// current run; exits holds why each run died. suspect is set when a
+	// connection dropped, to check that the server is alive before reusing it.
+	restarts int
+	exits    map[int]error
+	suspect  bool
+
+	// output holds the output of the latest run, output generation: a
+	// relaunch drops the output of the previous run.
+	output           *capture
+	outputGeneration int
+
+	// starting is held by the launch starting, checking or relaunching the
+	// server, see ready.
+	starting chan struct{}
+}
+
+// connection is a browser connected to run generation of server, launched
+// from site.
+type connection struct {
+	server     *browser
+	generation int
+	site       string
+}
+
+// launched is a browser returned by a launch. Closing it releases the server
+// it is connected to, which stops once no browser uses it anymore. So does
+// closing the browser through another handle, such as
+// page.Context().Browser(), which is seen when it disconnects, see
+// disconnected.
+type launched struct {
+	playwright.Browser
+	once sync.Once
+	s    *Session
+
+	// closing is set before the browser is closed, so that the disconnection
+	// it causes does not make the server suspect.
+	closing atomic.Bool
+}
+
+func (l *launched) Close(options ...playwright.BrowserCloseOptions) error {
+	l.closing.Store(true)
+	err := l.Browser.Close(options...)
+	l.once.Do(func() {
+		l.s.closed(l)
+	})
+	return err
+}
+
+// server returns the browser server for the given name and options,
+// allocating a container port to it the first time.
+// It must be called with the session's mutexBrowser held.
+func (s *Session) server(name string, o LaunchOptions) (*browser, error) {
+	key, err := o.key(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.Dedicated {
+		s.dedicated++
+		key = fmt.Sprintf("%s #%d", key, s.dedicated)
+	} else if b, ok := s.servers[key]; ok {
+		return b, nil
+	}
+
+	spec, ok := s.specs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown browser: %s", name)
+	}
+	if o.Channel != "" && spec.Type != "chromium" {
+		return nil, fmt.Errorf("could not launch %s: channel %q is only supported by chromium", name, o.Channel)
+	}
+
+	if s.servers == nil {
+		s.servers = map[string]*browser{}
+		s.ports = map[int]bool{}
+	}
+
+	port := spec.Port
+	if !o.isDefault() || s.ports[port] || s.shared {
+		base, size := s.portPool()
+		port = 0
+		for p := base; p < base+size; p++ {
+			if !s.ports[p] {
+				port = p
+				break
+			}
+		}
+		if port == 0 {
+			return nil, fmt.Errorf("could not launch %s: all %d ports of the pool are in use, see WithPortPool", name, size)
+		}
+	}
+
+	b := &browser{
+		session:      s,
+		key:          key,
+		spec:         spec,
+		instanceOf:   name,
+		instancePort: port,
+		options:      o,
+		starting:     make(chan struct{}, 1),
+	}
+	s.servers[key] = b
+	s.ports[port] = true
+	return b, nil
+}
+
+// release forgets a browser server that is not running anymore, freeing its port.
+// It must be called with the session's mutexBrowser held.
+func (s *Session) release(b *browser) {
+	if s.servers[b.key] == b {
+		delete(s.ports, b.instancePort)
+	}
+	s.forget(b)
+}
+
+// forget forgets a browser server and the browsers connected to it, but not
+// its port.
+// It must be called with the session's mutexBrowser held.
+func (s *Session) forget(b *browser) {
+	if s.servers[b.key] == b {
+		delete(s.servers, b.key)
+	}
+	for pb, c := range s.connections {
+		if c.server == b {
+			delete(s.connections, pb)
+		}
+	}
 }
 
-func (b *browser) connect() (playwright.Browser, error) {
-	mutexBrowser.Lock()
-	defer mutexBrowser.Unlock()
+// portPool returns the first port and the number of ports of the session's pool.
+func (s *Session) portPool() (int, int) {
+	switch {
+	case s.shared:
+		return portPoolBase + s.slot*reuseSlotPorts, reuseSlotPorts
+	case s.config == nil:
+		return portPoolBase, defaultPortPool
+	default:
+		return portPoolBase, s.config.portPool
+	}
+}
+
+// reserve takes a reference on the server for a launch, so that it does not
+// stop before the launch connected to it, see connect.
+// It must be called with the session's mutexBrowser held.
+func (b *browser) reserve() {
+	if b.idle != nil {
+		b.idle.Stop()
+		b.idle = nil
+	}
+	b.count++
+}
 
+// connect connects to the server, starting it if needed. It is called
+// without the session's mutexBrowser held, with a reference taken by
+// reserve, which it gives back if it fails.
+func (b *browser) connect(ctx context.Context) (playwright.Browser, error) {
+	s := b.session
+	if err := s.brokenErr(); err != nil {
+		b.cancel()
+		return nil, err
+	}
+
+	uri, generation, err := b.ready(ctx)
+	var pb playwright.Browser
+	if err == nil {
+		pb, err = s.connect(ctx, b.spec.Type, uri, b.options.SlowMo)
+	}
+	if err != nil {
+		b.cancel()
+		return nil, err
+	}
+
+	s.mutexBrowser.Lock()
+	if b.count == 0 {
+		// The session was closed meanwhile.
+		s.mutexBrowser.Unlock()
+		_ = pb.Close()
+		return nil, fmt.Errorf("could not launch %s: session is closed", b.instanceOf)
+	}
+	defer s.mutexBrowser.Unlock()
+	return b.track(pb, generation), nil
+}
+
+// ready starts the server if needed, or relaunches it if it died, and
+// returns its WebSocket URL and its run. Launches of the same server wait for
+// each other there, as long as ctx allows, but connect concurrently.
+func (b *browser) ready(ctx context.Context) (string, int, error) {
+	if err := ctx.Err(); err != nil {
+		return "", 0, fmt.Errorf("could not launch %s: %w", b.instanceOf, err)
+	}
+	select {
+	case b.starting <- struct{}{}:
+		defer func() { <-b.starting }()
+	case <-ctx.Done():
+		return "", 0, fmt.Errorf("could not launch %s: %w", b.instanceOf, ctx.Err())
+	}
+
+	s := b.session
+	s.mutexBrowser.Lock()
+	started, failed := b.running(), b.exits[b.restarts] != nil
+	s.mutexBrowser.Unlock()
+
+	if !started && !failed {
+		if err := b.start(ctx); err != nil {
+			return "", 0, err
+		}
+	} else if exit := b.check(ctx); exit != nil {
+		if err := b.restart(ctx, exit); err != nil {
+			return "", 0, err
+		}
+	}
+
+	s.mutexBrowser.Lock()
+	defer s.mutexBrowser.Unlock()
+	return b.uri, b.restarts, nil
+}
+
+// running reports whether the server was started and not stopped since.
+// It must be called with the session's mutexBrowser held.
+func (b *browser) running() bool {
+	return b.stop != nil
+}
+
+// cancel releases a reference on the server, see unref.
+func (b *browser) cancel() {
+	b.session.mutexBrowser.Lock()
+	stop := b.unref()
+	b.session.mutexBrowser.Unlock()
+	stop()
+}
+
+// unref releases a reference on the server. Once unused, the server is
+// stopped after the idle timeout, or right away for dedicated servers that
+// no launch can reuse and servers that did not start. It returns the
+// function stopping the server, see shutdown.
+// It must be called with the session's mutexBrowser held.
+func (b *browser) unref() func() {
+	if b.count == 0 {
+		// The server was shut down meanwhile.
+		return func() {}
+	}
+	b.count--
 	if b.count > 0 {
-		b.count++
-		return connect(b.instanceOf, b.uri)
+		return func() {}
+	}
+
+	idle := b.session.idleTimeout()
+	if idle <= 0 || b.options.Dedicated || !b.running() {
+		return b.shutdown()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(idle, func() {
+		b.session.mutexBrowser.Lock()
+		stop := func() {}
+		if b.idle == timer {
+			stop = b.shutdown()
+		}
+		b.session.mutexBrowser.Unlock()
+		stop()
+	})
+	b.idle = timer
+	return func() {}
+}
+
+// shutdown forgets the server whatever its references. It returns the
+// function stopping it, to be called once the session's mutexBrowser is
+// released; its port is freed once it stopped.
+// It must be called with the session's mutexBrowser held.
+func (b *browser) shutdown() func() {
+	if b.idle != nil {
+		b.idle.Stop()
+		b.idle = nil
+	}
+	b.count = 0
+
+	s := b.session
+	stop := b.stop
+	b.stop = nil
+	if stop == nil {
+		s.release(b)
+		return func() {}
+	}
+
+	// The port stays taken until the server stopped listening on it.
+	owned := s.servers[b.key] == b
+	s.forget(b)
+	return func() {
+		stop()
+		if owned {
+			s.mutexBrowser.Lock()
+			defer s.mutexBrowser.Unlock()
+			delete(s.ports, b.instancePort)
+		}
+	}
+}
+
+// closed releases the server of a launched browser that was closed.
+func (s *Session) closed(l *launched) {
+	s.mutexBrowser.Lock()
+	c, ok := s.connections[l]
+	if !ok {
+		// The session was closed first.
+		s.mutexBrowser.Unlock()
+		return
+	}
+	delete(s.connections, l)
+	stop := c.server.unref()
+	s.mutexBrowser.Unlock()
+	stop()
+}
+
+// leaks lists the browsers launched but never closed.
+// It must be called with the session's mutexBrowser held.
+func (s *Session) leaks() []string {
+	leaks := []string{}
+	for _, c := range s.connections {
+		leaks = append(leaks, fmt.Sprintf("%s launched at %s", c.server.instanceOf, c.site))
+	}
+	slices.Sort(leaks)
+	return leaks
+}
+
+// check makes sure a server a connection dropped from is still running, and
+// returns why its current run died, if it did.
+// It must be called by the launch holding starting.
+func (b *browser) check(ctx context.Context) error {
+	s := b.session
+	s.mutexBrowser.Lock()
+	generation := b.restarts
+	exit, suspect := b.exits[generation], b.suspect
+	s.mutexBrowser.Unlock()
+	if !suspect || exit != nil {
+		return exit
+	}
+	browsers := s.running()
+	if browsers == nil {
+		return nil
+	}
+
+	alive, err := browsers.alive(ctx, b.instancePort)
+	if err != nil {
+		// Connecting tells just as well.
+		return nil
+	}
+
+	s.mutexBrowser.Lock()
+	defer s.mutexBrowser.Unlock()
+	b.suspect = false
+	if !alive {
+		b.died(generation, &BrowserServerError{Browser: b.instanceOf, ExitCode: -1, Err: errServerGone})
+	}
+	return b.exits[generation]
+}
+
+// restart relaunches a server whose run died of exit, as long as the restart
+// budget allows.
+// It must be called by the launch holding starting.
+func (b *browser) restart(ctx context.Context, exit error) error {
+	s := b.session
+	s.mutexBrowser.Lock()
+	spent := b.restarts >= s.maxRestarts()
+	closed := b.count == 0
+	stop := b.stop
+	s.mutexBrowser.Unlock()
+	if spent {
+		return fmt.Errorf("could not launch %s: %w: %w", b.instanceOf, ErrRestartBudget, exit)
+	}
+	if closed {
+		return fmt.Errorf("could not launch %s: session is closed", b.instanceOf)
+	}
+
+	// stop is nil when the last relaunch failed: nothing runs anymore.
+	if stop != nil {
+		stop()
+	}
+	s.mutexBrowser.Lock()
+	b.stop = nil
+	b.restarts++
+	b.suspect = false
+	s.mutexBrowser.Unlock()
+
+	if err := b.start(ctx); err != nil {
+		s.mutexBrowser.Lock()
+		defer s.mutexBrowser.Unlock()
+		b.died(b.restarts, err)
+		return fmt.Errorf("could not restart %s after %w: %w", b.instanceOf, exit, err)
+	}
+	return nil
+}
+
+// died records that run generation of the server exited with err.
+// It must be called with the session's mutexBrowser held.
+func (b *browser) died(generation int, err error) {
+	if b.exits == nil {
+		b.exits = map[int]error{}
+	}
+	b.exits[generation] = err
+}
+
+// track watches a browser connected to run generation of the server, and
+// wraps it so that closing it releases the server.
+// It must be called with the session's mutexBrowser held.
+func (b *browser) track(pb playwright.Browser, generation int) playwright.Browser {
+	s := b.session
+	if s.connections == nil {
+		s.connections = map[playwright.Browser]connection{}
 	}
+	l := &launched{Browser: pb, s: s}
+	s.connections[l] = connection{server: b, generation: generation, site: caller()}
 
+	pb.OnDisconnected(func(playwright.Browser) {
+		if l.closing.Load() {
+			return
+		}
+		// Events are dispatched by the connection, which a launch holding
+		// the lock may be waiting for.
+		go b.disconnected(l, generation)
+	})
+	return l
+}
+
+// disconnected handles a browser connected to run generation of the server
+// that disconnected without being closed through l: either it was closed
+// through another handle, which releases the server, or the server died,
+// which the next launch relaunches. The browser stays known until closed in
+// the latter case, see BrowserErr.
+func (b *browser) disconnected(l *launched, generation int) {
+	s := b.session
+	s.mutexBrowser.Lock()
+	if b.restarts == generation {
+		b.suspect = true
+	}
+	s.mutexBrowser.Unlock()
+
+	browsers := s.running()
+	if browsers == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(browsers.context, 10*time.Second)
+	defer cancel()
+	alive, err := browsers.alive(ctx, b.instancePort)
+	if err != nil || !alive {
+		return
+	}
+
+	s.mutexBrowser.Lock()
+	current := b.restarts == generation
+	s.mutexBrowser.Unlock()
+	if current {
+		l.once.Do(func() {
+			s.closed(l)
+		})
+	}
+}
+
+// caller returns the position of the code that called into the package.
+func caller() string {
+	_, self, _, _ := runtime.Caller(0)
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		frame, more := frames.Next()
+		if filepath.Dir(frame.File) != filepath.Dir(self) || strings.HasSuffix(frame.File, "_test.go") {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
+
+// start starts the current run of the server.
+// It must be called by the launch holding starting.
+func (b *browser) start(ctx context.Context) error {
+	s := b.session
+	browsers := s.running()
 	if browsers == nil {
-		return nil, fmt.Errorf("container is not running")
+		return fmt.Errorf("container is not running")
 	}
 
-	uri, cancel, err := browsers.Exec(b.instanceOf, b.instancePort)
+	options, err := b.options.server(b.instancePort, b.spec.Name)
 	if err != nil {
-		return nil, fmt.Errorf("could not exec chromium: %w", err)
+		return fmt.Errorf("invalid launch options for %s: %w", b.instanceOf, err)
+	}
+
+	s.mutexBrowser.Lock()
+	generation := b.restarts
+	output := &capture{}
+	b.output, b.outputGeneration = output, generation
+	s.mutexBrowser.Unlock()
+
+	exited := func(err error) {
+		s.fail(err)
+
+		s.mutexBrowser.Lock()
+		defer s.mutexBrowser.Unlock()
+		b.died(generation, err)
 	}
-	b.uri = uri
-	b.cancel = func() {
-		mutexBrowser.Lock()
-		defer mutexBrowser.Unlock()
 
-		b.count--
-		if b.count == 0 {
-			cancel()
+	uri, stop, err := browsers.Exec(ctx, b.spec, b.instancePort, options, output, exited)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return fmt.Errorf("could not launch %s: %w", b.instanceOf, ctxErr)
 		}
+		return fmt.Errorf("could not exec %s: %w", b.instanceOf, err)
 	}
-	b.count++
 
-	return connect(b.instanceOf, b.uri)
+	s.mutexBrowser.Lock()
+	if b.count == 0 {
+		// The session was closed meanwhile.
+		s.mutexBrowser.Unlock()
+		stop()
+		return fmt.Errorf("could not launch %s: session is closed", b.instanceOf)
+	}
+	defer s.mutexBrowser.Unlock()
+	b.uri = uri
+	b.stop = stop
+	return nil
+}
+
+// idleTimeout returns how long the session's unused servers keep running.
+func (s *Session) idleTimeout() time.Duration {
+	if s.config == nil {
+		return defaultIdleTimeout
+	}
+	return s.config.idle
+}
+
+// maxRestarts returns how many times each server of the session may be relaunched.
+func (s *Session) maxRestarts() int {
+	if s.config == nil {
+		return defaultMaxRestarts
+	}
+	return s.config.restarts
+}
+
+// BrowserErr returns why the server of a browser obtained from the default
+// session died, or nil while it runs. See Session.BrowserErr.
+func BrowserErr(pb playwright.Browser) error {
+	s, err := defaultSession()
+	if err != nil {
+		return err
+	}
+	return s.BrowserErr(pb)
 }
 
-func connect(instanceOf, uri string) (playwright.Browser, error) {
+// BrowserErr returns the *BrowserServerError of the server pb was connected
+// to if that server died, even if it was restarted since, or nil otherwise.
+// It tells a test that lost its browser why, until the browser is closed.
+func (s *Session) BrowserErr(pb playwright.Browser) error {
+	s.mutexBrowser.Lock()
+	defer s.mutexBrowser.Unlock()
+
+	c, ok := s.connections[pb]
+	if !ok {
+		return nil
+	}
+	return c.server.exits[c.generation]
+}
+
+// connect connects to the server at uri with the Playwright browser type instanceOf.
+func (s *Session) connect(ctx context.Context, instanceOf, uri string, slowMo time.Duration) (playwright.Browser, error) {
+	options := playwright.BrowserTypeConnectOptions{}
+	if slowMo > 0 {
+		options.SlowMo = playwright.Float(float64(slowMo.Milliseconds()))
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		// Playwright treats a zero timeout as none at all.
+		options.Timeout = playwright.Float(float64(max(time.Until(deadline).Milliseconds(), 1)))
+	}
+
+	var pb playwright.Browser
+	var err error
 	switch instanceOf {
 	case "chromium":
-		return pw.Chromium.Connect(uri)
+		pb, err = s.pw.Chromium.Connect(uri, options)
 	case "firefox":
-		return pw.Firefox.Connect(uri)
+		pb, err = s.pw.Firefox.Connect(uri, options)
 	case "webkit":
-		return pw.WebKit.Connect(uri)
+		pb, err = s.pw.WebKit.Connect(uri, options)
 	default:
 		return nil, fmt.Errorf("unknown browser instance: %s", instanceOf)
 	}
-}
-
-var chromium = browser{
-	instanceOf:   "chromium",
-	instancePort: 1024 + 3,
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, fmt.Errorf("could not launch %s: %w", instanceOf, ctxErr)
+		}
+		return nil, err
+	}
+	return pb, nil
 }
 
 // Chromium launches a Chromium browser instance in the container
@@ -76,12 +638,18 @@ var chromium = browser{
 // You should call browser.Close() when you're done with the browser.
 // The API of the returned browser object is the Playwright API.
 func Chromium() (playwright.Browser, error) {
-	return chromium.connect()
+	return ChromiumContext(context.Background())
 }
 
-var firefox = browser{
-	instanceOf:   "firefox",
-	instancePort: 1024 + 1,
+// ChromiumContext is like Chromium, but ctx bounds the launch: starting the
+// server, mapping its port and connecting to it. If ctx expires first, the
+// returned error wraps ctx.Err().
+func ChromiumContext(ctx context.Context) (playwright.Browser, error) {
+	s, err := defaultSession()
+	if err != nil {
+		return nil, err
+	}
+	return s.ChromiumContext(ctx)
 }
 
 // Firefox launches a Firefox browser instance in the container
@@ -92,12 +660,18 @@ var firefox = browser{
 // You should call browser.Close() when you're done with the browser.
 // The API of the returned browser object is the Playwright API.
 func Firefox() (playwright.Browser, error) {
-	return firefox.connect()
+	return FirefoxContext(context.Background())
 }
 
-var webkit = browser{
-	instanceOf:   "webkit",
-	instancePort: 1024 + 2,
+// FirefoxContext is like Firefox, but ctx bounds the launch: starting the
+// server, mapping its port and connecting to it. If ctx expires first, the
+// returned error wraps ctx.Err().
+func FirefoxContext(ctx context.Context) (playwright.Browser, error) {
+	s, err := defaultSession()
+	if err != nil {
+		return nil, err
+	}
+	return s.FirefoxContext(ctx)
 }
 
 // Webkit launches a WebKit browser instance in the container
@@ -108,5 +682,44 @@ var webkit = browser{
 // You should call browser.Close() when you're done with the browser.
 // The API of the returned browser object is the Playwright API.
 func Webkit() (playwright.Browser, error) {
-	return webkit.connect()
+	return WebkitContext(context.Background())
+}
+
+// WebkitContext is like Webkit, but ctx bounds the launch: starting the
+// server, mapping its port and connecting to it. If ctx expires first, the
+// returned error wraps ctx.Err().
+func WebkitContext(ctx context.Context) (playwright.Browser, error) {
+	s, err := defaultSession()
+	if err != nil {
+		return nil, err
+	}
+	return s.WebkitContext(ctx)
+}
+
+// BrowserOutput returns the output of the server of a browser obtained from
+// the default session. See Session.BrowserOutput.
+func BrowserOutput(pb playwright.Browser) string {
+	s, err := defaultSession()
+	if err != nil {
+		return ""
+	}
+	return s.BrowserOutput(pb)
+}
+
+// BrowserOutput returns the combined stdout and stderr of the server pb is
+// connected to, since it was launched or relaunched, until the browser is
+// closed or the server relaunched. Only the last megabyte is kept. It is meant to be attached to the
+// report of a failed test.
+func (s *Session) BrowserOutput(pb playwright.Browser) string {
+	s.mutexBrowser.Lock()
+	defer s.mutexBrowser.Unlock()
+
+	c, ok := s.connections[pb]
+	if !ok {
+		return ""
+	}
+	if c.server.output == nil || c.server.outputGeneration != c.generation {
+		return ""
+	}
+	return c.server.output.String()
 }
@@ -3,15 +3,20 @@ package playwrightcigo
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os/exec"
 	"runtime/debug"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/moby/moby/api/pkg/stdcopy"
+	"github.com/moby/moby/client"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/wait"
 )
@@ -22,17 +27,73 @@ type config struct {
 	sleeping   time.Duration
 	repository string
 	tag        string
+	tagSource  string
+	variant    string
 	retry      int
-	verbose    bool
+	portPool   int
+	reuse      string
+	lease      time.Duration
+	restarts   int
+	idle       time.Duration
+	logger     *slog.Logger
+	output     io.Writer
+
+	// serverDebug is the DEBUG of the browser servers, see WithServerDebug.
+	serverDebug string
+
+	// har is the directory HAR files are recorded in, harBodyLimit how much
+	// of each body they keep, and harHTTPS whether HTTPS requests are
+	// recorded, see WithHARRecording.
+	har          string
+	harBodyLimit int
+	harHTTPS     bool
+
+	// replay is the HAR file the proxy answers from, see WithHARReplay.
+	replay          string
+	replayPolicy    ReplayPolicy
+	replayMatchBody bool
+
+	// hosts are resolved by the proxy, see WithHostMapping.
+	hosts []hostMapping
+
+	// proxy holds the Go handlers of the proxied requests, see Session.Proxy.
+	proxy *Proxy
+
+	requireDocker bool
+
+	observers observers
+
+	// signals is how long the teardown on SIGINT and SIGTERM may take, or 0
+	// when Install handles no signal, see WithSignalHandler.
+	signals time.Duration
 }
 
 type container struct {
 	context    context.Context
 	proxy      string
 	proxyPort  int
-	proxyClose func()
+	proxyClose func() error
 	browsers   testcontainers.Container
+	image      string
+	observer   Observer
+	log        *slog.Logger
+	output     io.Writer
 	terminate  func()
+
+	// serverDebug is the DEBUG of the browser servers, see WithServerDebug.
+	serverDebug string
+
+	// slot is the lease of this process on the container. When the
+	// container is shared with other processes, see WithReuse, it is also
+	// the range of ports of the pool this process uses.
+	slot   int
+	shared bool
+
+	// digest is the digest of the image in its repository, once digested,
+	// see imageDigest.
+	mutexDigest sync.Mutex
+	digest      string
+	digested    bool
 }
 
 type module struct {
@@ -41,147 +102,456 @@ type module struct {
 	Main    bool
 }
 
-func new(opts ...Option) (*container, error) {
+func newConfig(opts ...Option) *config {
 	c := &config{
-		timeout:    5 * time.Minute,
-		sleeping:   200 * time.Millisecond,
-		retry:      15,
-		ctx:        context.Background(),
-		repository: "ghcr.io/mountain-reverie/playwright-ci-go",
-		tag:        "",
-		verbose:    false,
+		timeout:  5 * time.Minute,
+		sleeping: 200 * time.Millisecond,
+		retry:    15,
+		portPool: defaultPortPool,
+		restarts: defaultMaxRestarts,
+		idle:     defaultIdleTimeout,
+		lease:    defaultLease,
+
+		harBodyLimit: defaultHARBodyLimit,
+		ctx:          context.Background(),
+		repository:   "ghcr.io/mountain-reverie/playwright-ci-go",
+		tag:          "",
+		proxy:        &Proxy{},
 	}
 	for _, opt := range opts {
 		opt.apply(c)
 	}
+	if c.logger == nil {
+		c.logger = slog.Default()
+	}
+	return c
+}
+
+// debug reports whether debug records are logged, in which case the
+// Playwright driver and the proxy are verbose too.
+func (c *config) debug() bool {
+	return c.logger.Enabled(context.Background(), slog.LevelDebug)
+}
+
+// new starts the browser container and its transparent proxy, exposing the
+// ports of the given browsers. Failures of the proxy serving in the
+// background are sent to errs.
+func new(c *config, specs map[string]BrowserSpec, errs chan<- error) (*container, error) {
+	if err := c.resolveTag(); err != nil {
+		return nil, err
+	}
+
+	image := fmt.Sprintf("%s:%s", c.repository, c.tag)
+	if c.variant != "" {
+		image += "-" + c.variant
+	}
+
+	c.observers.ContainerStarting(image)
+	browsers, err := startContainer(c, image, specs, errs)
+	id := ""
+	if err == nil {
+		id = browsers.browsers.GetContainerID()
+	}
+	c.observers.ContainerStarted(image, id, err)
+	return browsers, err
+}
 
+// resolveTag finds the image tag when WithRepository gave none, and records
+// how the tag was resolved.
+func (c *config) resolveTag() error {
 	if c.tag == "" {
-		tag, err := noTagVersion(c.verbose)
+		tag, source, err := noTagVersion(c.logger)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		c.tag = tag
+		c.tagSource = source
+	} else if c.tagSource == "" {
+		c.tagSource = TagFromOption
 	}
+	c.logger.Debug("resolved image tag", "tag", c.tag, "tag_source", c.tagSource)
+	return nil
+}
 
-	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
-
-	timeoutSecond := int(c.timeout.Seconds())
-
-	proxy, proxyPort, close := transparentProxy(c.retry, c.sleeping, c.verbose)
+// startContainer starts the container of image or, with WithReuse, attaches
+// to the one shared under that name.
+func startContainer(c *config, image string, specs map[string]BrowserSpec, errs chan<- error) (*container, error) {
+	// The container lives as long as its lease is renewed, only starting it
+	// is bounded by the timeout.
+	ctx, cancel := context.WithCancel(c.ctx)
+	start, startCancel := context.WithTimeout(ctx, c.timeout)
+	defer startCancel()
+
+	if c.reuse != "" {
+		browsers, err := reuse(ctx, start, cancel, c, image, specs, errs)
+		if !errors.Is(err, errNoSlot) {
+			return browsers, err
+		}
+		c.logger.Debug("starting a container of our own", "error", err)
+	}
 
-	if c.verbose {
-		log.Println("Starting browser container", fmt.Sprintf("%s:%s", c.repository, c.tag))
+	proxy, proxyPort, close, err := transparentProxy("127.0.0.1", testcontainers.HostInternal, c, errs)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("could not start transparent proxy: %w", err)
 	}
+
+	c.logger.Debug("starting browser container", "image", image)
 	genericContainerReq := testcontainers.GenericContainerRequest{
 		ContainerRequest: testcontainers.ContainerRequest{
-			Image:           fmt.Sprintf("%s:%s", c.repository, c.tag),
+			Image:           image,
 			HostAccessPorts: []int{int(proxyPort)},
 			WorkingDir:      "/src",
-			ExposedPorts:    []string{"1025/tcp", "1026/tcp", "1027/tcp"},
-			Cmd:             []string{fmt.Sprintf("sleep %v", timeoutSecond+10)},
-			WaitingFor:      wait.ForExec([]string{"echo", "ready"}),
+			ExposedPorts:    exposedPorts(specs, c.portPool),
+			Cmd:             []string{lifetime, "playwright-ci-go", leaseDir, strconv.Itoa(leaseSeconds(c.lease))},
+			WaitingFor:      wait.ForExec([]string{"test", "-d", leaseDir + "/slots"}),
 		},
 		Started: true,
 	}
 
-	browsers, err := testcontainers.GenericContainer(ctx, genericContainerReq)
+	browsers, err := testcontainers.GenericContainer(start, genericContainerReq)
 	if err != nil {
+		_ = close()
 		cancel()
 		return nil, fmt.Errorf("could not start browser container: %w", err)
 	}
 
-	return &container{
+	private := &container{
 		context:    ctx,
 		proxy:      proxy,
 		proxyPort:  proxyPort,
 		proxyClose: close,
 		browsers:   browsers,
+		image:      image,
+		observer:   c.observers,
+		log:        c.logger.With("container_id", browsers.GetContainerID()),
+		output:     c.output,
 		terminate:  cancel,
-	}, nil
+
+		serverDebug: c.serverDebug,
+	}
+	if err := private.attach(start, 1, c.lease, errs); err != nil {
+		_ = private.close()
+		return nil, err
+	}
+	return private, nil
+}
+
+// leaseSeconds returns ttl in whole seconds, at least one.
+func leaseSeconds(ttl time.Duration) int {
+	return max(int(ttl.Seconds()), 1)
+}
+
+// exposedPorts lists the container ports the servers of the given browsers
+// may listen on: their own and those of the pool.
+func exposedPorts(specs map[string]BrowserSpec, pool int) []string {
+	defaults := []int{}
+	for _, spec := range specs {
+		defaults = append(defaults, spec.Port)
+	}
+
+	ports := []string{}
+	for _, p := range slices.Sorted(slices.Values(defaults)) {
+		ports = append(ports, fmt.Sprintf("%d/tcp", p))
+	}
+	for p := portPoolBase; p < portPoolBase+pool; p++ {
+		ports = append(ports, fmt.Sprintf("%d/tcp", p))
+	}
+	return ports
 }
 
 // Close terminates the container and cleans up associated resources.
 func (c *container) Close() error {
-	if err := c.browsers.Terminate(context.Background()); err != nil {
-		return fmt.Errorf("could not terminate browser container: %w", err)
-	}
-	c.proxyClose()
+	err := c.close()
+	c.observer.ContainerStopped(c.browsers.GetContainerID(), err)
+	return err
+}
+
+func (c *container) close() error {
+	// Stop renewing the lease first.
 	c.terminate()
-	return nil
+
+	var err error
+	if c.shared {
+		// Others may still use the container, which stops once idle.
+		err = c.detach()
+	} else if err = c.browsers.Terminate(context.Background()); err != nil {
+		err = fmt.Errorf("could not terminate browser container: %w", err)
+	}
+	return errors.Join(err, c.proxyClose())
 }
 
-// Exec executes a browser command in the container and returns a WebSocket connection URL.
-// The browser parameter should be one of: "chromium", "firefox", or "webkit".
-// It also returns a cancel function to terminate the browser session.
-func (c *container) Exec(browser string, containerPort int) (string, context.CancelFunc, error) {
+// Exec executes the script of a browser in the container and returns a WebSocket connection URL.
+// The server listens on containerPort, and options holds its JSON launchServer options.
+// It also returns a function stopping the server, which frees its port.
+// If the server process exits before it is ready, Exec returns its
+// *BrowserServerError; if it exits later without being stopped, the error is
+// passed to exited. Its output is written to output.
+//
+// ctx only bounds waiting for the server to be ready: once started, the
+// server lives as long as the container or until cancelled.
+func (c *container) Exec(ctx context.Context, spec BrowserSpec, containerPort int, options []byte, output *capture, exited func(error)) (string, func(), error) {
+	// The launch may give up earlier than the container, but not later.
+	launchCtx, launchCancel := context.WithCancel(ctx)
+	defer launchCancel()
+	stop := context.AfterFunc(c.context, launchCancel)
+	defer stop()
+
+	// A server failing before it is ready is returned by Exec, a later
+	// failure is passed to exited.
+	var mutex sync.Mutex
+	var failure error
+	ready := false
+
+	c.observer.BrowserLaunching(spec.Name, containerPort)
+
 	execCtx, execCancel := context.WithCancel(c.context)
 	go func() {
-		code, stuff, err := c.browsers.Exec(execCtx, []string{"node", browser + ".js", c.proxy, strconv.Itoa(c.proxyPort)})
-
-		// Check that the context is not expired
-		select {
-		case <-execCtx.Done():
-			return
-		default:
-		}
+		err := c.run(execCtx, spec, containerPort, options, output)
 
-		if err != nil {
-			log.Fatalf("Could not exec in browser container: %s", err)
-		}
-		if code != 0 {
-			s, err := io.ReadAll(stuff)
+		mutex.Lock()
+		if ready {
+			mutex.Unlock()
+			c.observer.BrowserExited(spec.Name, containerPort, err)
+			c.log.Debug("browser server exited", "browser", spec.Name, "port", containerPort, "error", err)
 			if err != nil {
-				fmt.Println("Could not read stdout/stderr from browser container:", err)
-			} else {
-				fmt.Println("Browser container output:", string(s))
+				exited(err)
 			}
-			log.Fatalf("Exec failed in browser container: %d", code)
+			return
+		}
+		if err == nil {
+			mutex.Unlock()
+			return
 		}
+		failure = err
+		launchCancel()
+		mutex.Unlock()
 	}()
 
-	host, err := c.browsers.Host(c.context)
+	uri, err := c.endpoint(launchCtx, spec.Name, containerPort)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if failure != nil {
+		err = failure
+	}
+	ready = err == nil
+	c.observer.BrowserLaunched(spec.Name, containerPort, uri, err)
+	c.log.Debug("launched browser server", "browser", spec.Name, "port", containerPort, "error", err)
+	if failure != nil {
+		execCancel()
+		return "", nil, failure
+	}
 	if err != nil {
 		execCancel()
-		return "", nil, fmt.Errorf("could not get browser host: %w", err)
+		_ = c.stop(containerPort)
+		return "", nil, err
 	}
 
-	p, err := port(c.context, c.browsers, host, containerPort)
-	if err != nil {
+	return uri, func() {
 		execCancel()
-		return "", nil, fmt.Errorf("could not get %s port: %w", browser, err)
+		if err := c.stop(containerPort); err != nil {
+			c.log.Warn("could not stop browser server", "browser", spec.Name, "error", err)
+		}
+	}, nil
+}
+
+// stop terminates the server listening on containerPort, if any, and waits
+// for it to exit so that the port can be reused.
+func (c *container) stop(containerPort int) error {
+	ctx, cancel := context.WithTimeout(c.context, 10*time.Second)
+	defer cancel()
+
+	// Ask nicely for 5 seconds, then kill.
+	script := `pid=$(cat "$0" 2>/dev/null) || exit 0
+kill "$pid" 2>/dev/null
+for i in $(seq 50); do
+	kill -0 "$pid" 2>/dev/null || break
+	sleep 0.1
+done
+kill -9 "$pid" 2>/dev/null
+rm -f "$0"`
+	code, _, err := c.browsers.Exec(ctx, []string{"sh", "-c", script, pidFile(containerPort)})
+	if err != nil {
+		return err
+	}
+	if code != 0 {
+		return fmt.Errorf("stopping exited with code %d", code)
+	}
+	return nil
+}
+
+// alive reports whether the server listening on containerPort is still running.
+func (c *container) alive(ctx context.Context, containerPort int) (bool, error) {
+	code, _, err := c.browsers.Exec(ctx, []string{"sh", "-c", `kill -0 "$(cat "$0")" 2>/dev/null`, pidFile(containerPort)})
+	if err != nil {
+		return false, err
+	}
+	return code == 0, nil
+}
+
+// pidFile is where the pid of the server listening on containerPort is kept.
+func pidFile(containerPort int) string {
+	return fmt.Sprintf("/tmp/playwright-ci-go-%d.pid", containerPort)
+}
+
+// endpoint waits for the server of browser to listen on containerPort and
+// returns its WebSocket URL.
+func (c *container) endpoint(ctx context.Context, browser string, containerPort int) (string, error) {
+	host, err := c.browsers.Host(ctx)
+	if err != nil {
+		return "", fmt.Errorf("could not get browser host: %w", err)
+	}
+
+	p, err := port(ctx, c.browsers, host, containerPort, c.observer, c.log)
+	if err != nil {
+		return "", fmt.Errorf("could not get %s port: %w", browser, err)
+	}
+
+	return fmt.Sprintf("ws://%s:%d/"+browser, host, p), nil
+}
+
+// run runs the server of the given browser until it exits or ctx is done,
+// writing its output to output and to the writer given to WithOutput.
+// It returns a *BrowserServerError if the server could not run or exited
+// while ctx was not done: a server never exits on its own, even with code 0.
+func (c *container) run(ctx context.Context, spec BrowserSpec, containerPort int, options []byte, output *capture) error {
+	browser := spec.Name
+	// Cancelling the exec does not end the process in the container, so
+	// record its pid for stop.
+	cmd := []string{"sh", "-c", `echo $$ > "$0" && exec node "$@"`, pidFile(containerPort), spec.Script, c.proxy, strconv.Itoa(c.proxyPort), string(options)}
+
+	// Playwright logs what it does when DEBUG is set, see WithServerDebug.
+	env := []string{}
+	if c.serverDebug != "" {
+		env = append(env, "DEBUG="+c.serverDebug)
+	}
+
+	var w io.Writer = output
+	if c.output != nil {
+		// Only the failures of output fail the server.
+		live := &prefixWriter{w: &lenientWriter{w: c.output, logger: c.log, browser: browser}, prefix: "[" + browser + "] "}
+		defer func() {
+			_ = live.Flush()
+		}()
+		w = io.MultiWriter(output, live)
+	}
+	code, err := c.stream(ctx, cmd, env, w)
+
+	// Check that the context is not expired
+	select {
+	case <-ctx.Done():
+		return nil
+	default:
+	}
+
+	if err != nil {
+		return &BrowserServerError{Browser: browser, ExitCode: -1, Err: err, Output: output.String()}
+	}
+
+	serverErr := &BrowserServerError{Browser: browser, ExitCode: code, Output: output.String()}
+	if code == exitChannelUnavailable {
+		serverErr.Err = ErrChannelUnavailable
+	}
+	return serverErr
+}
+
+// stream runs cmd in the container with the additional environment env,
+// writing its stdout and stderr to w as they come, and returns its exit code
+// once it exited, or ctx.Err() once ctx is done.
+func (c *container) stream(ctx context.Context, cmd, env []string, w io.Writer) (int, error) {
+	cli, err := testcontainers.NewDockerClientWithOpts(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("could not connect to docker: %w", err)
+	}
+	defer cli.Close()
+
+	created, err := cli.ExecCreate(ctx, c.browsers.GetContainerID(), client.ExecCreateOptions{
+		Cmd:          cmd,
+		Env:          env,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("container exec create: %w", err)
+	}
+
+	hijack, err := cli.ExecAttach(ctx, created.ID, client.ExecAttachOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("container exec attach: %w", err)
+	}
+	defer hijack.Close()
+
+	// The daemon closes the stream once the process exited.
+	copied := make(chan error, 1)
+	go func() {
+		_, err := stdcopy.StdCopy(w, w, hijack.Reader)
+		copied <- err
+	}()
+	select {
+	case err := <-copied:
+		if err != nil {
+			return 0, fmt.Errorf("container exec read: %w", err)
+		}
+	case <-ctx.Done():
+		// Closing the stream ends the copy, which must not write to w once
+		// stream returned.
+		hijack.Close()
+		<-copied
+		return 0, ctx.Err()
 	}
 
-	return fmt.Sprintf("ws://%s:%d/"+browser, host, p), execCancel, nil
+	// The daemon marks the exec as exited shortly after closing the stream.
+	for {
+		inspect, err := cli.ExecInspect(ctx, created.ID, client.ExecInspectOptions{})
+		if err != nil {
+			return 0, fmt.Errorf("container exec inspect: %w", err)
+		}
+		if !inspect.Running {
+			return inspect.ExitCode, nil
+		}
+		if err := SleepWithContext(ctx, 10*time.Millisecond); err != nil {
+			return 0, err
+		}
+	}
 }
 
-func port(ctx context.Context, container testcontainers.Container, host string, port int) (int, error) {
+func port(ctx context.Context, container testcontainers.Container, host string, port int, observer Observer, logger *slog.Logger) (int, error) {
 	p, err := container.MappedPort(ctx, fmt.Sprintf("%d/tcp", port))
 	if err != nil {
 		return 0, fmt.Errorf("could not get browser port: %w", err)
 	}
-	if err := Wait4Port(fmt.Sprintf("http://%s:%d", host, p.Num())); err != nil {
+	if err := Wait4Port(fmt.Sprintf("http://%s:%d", host, p.Num()), WithContext(ctx), WithObserver(observer), WithLogger(logger)); err != nil {
 		return 0, fmt.Errorf("timeout, could not connect to browser container: %w", err)
 	}
 	return int(p.Num()), nil
 }
 
+// Where the image tag came from, see Status.
+const (
+	TagFromOption    = "WithRepository"
+	TagFromBuildInfo = "build info"
+	TagFromGoList    = "go list"
+	TagFromGit       = "git describe"
+)
+
 // noTagVersion resolves which playwright-ci-go image to pull when the caller
-// did not pin one with WithRepository.
+// did not pin one with WithRepository, and returns which strategy found it.
 //
 // Both strategies read versions the Go toolchain already knows, so neither
 // guesses. Build info covers consumers of this library; go list covers
 // development inside this repository, where the test binary carries no
-// dependency info.
-func noTagVersion(verbose bool) (string, error) {
-	if imageVersion, found := getPlaywrightCIGoFromBuildInfo(verbose); found {
-		return imageVersion, nil
+// dependency info, falling back to the git tag of the repository.
+func noTagVersion(logger *slog.Logger) (string, string, error) {
+	if imageVersion, found := getPlaywrightCIGoFromBuildInfo(logger); found {
+		return imageVersion, TagFromBuildInfo, nil
 	}
 
-	if imageVersion, found := getPlaywrightCIGoFromGoList(verbose); found {
-		return imageVersion, nil
+	if imageVersion, source, found := getPlaywrightCIGoFromGoList(logger); found {
+		return imageVersion, source, nil
 	}
 
-	return "", fmt.Errorf("could not determine which %s image to use: no version found in build info or go list; pass one explicitly with WithRepository", playwrightCIGoModule)
+	return "", "", fmt.Errorf("could not determine which %s image to use: no version found in build info or go list; pass one explicitly with WithRepository", playwrightCIGoModule)
 }
 
 func filterVersion(version string) string {
@@ -193,64 +563,56 @@ func filterVersion(version string) string {
 	return version
 }
 
-func getPlaywrightCIGoGitVersion(verbose bool) (string, bool) {
+func getPlaywrightCIGoGitVersion(logger *slog.Logger) (string, bool) {
 	cmd := exec.Command("git", "describe", "--tags")
 	output, err := cmd.Output()
 	if err != nil {
-		if verbose {
-			log.Printf("could not get git version: %v\n", err)
-		}
+		logger.Debug("could not get git version", "tag_source", TagFromGit, "error", err)
 		return "", false
 	}
 	imageVersion := filterVersion(strings.TrimSpace(string(output)))
-	if verbose {
-		log.Println("Using version from git:", imageVersion)
-	}
+	logger.Debug("using version from git", "tag_source", TagFromGit, "tag", imageVersion)
 	return imageVersion, true
 }
 
-func getPlaywrightCIGoFromBuildInfo(verbose bool) (string, bool) {
+func getPlaywrightCIGoFromBuildInfo(logger *slog.Logger) (string, bool) {
 	info, ok := debug.ReadBuildInfo()
 	if !ok {
-		if verbose {
-			log.Println("no build info available")
-		}
+		logger.Debug("no build info available", "tag_source", TagFromBuildInfo)
 		return "", false
 	}
 
-	return versionFromBuildInfo(info, verbose)
+	return versionFromBuildInfo(info, logger)
 }
 
-func getPlaywrightCIGoFromGoList(verbose bool) (string, bool) {
+func getPlaywrightCIGoFromGoList(logger *slog.Logger) (string, string, bool) {
 	cmd := exec.Command("go", "list", "-json", "-m", "all")
 	output, err := cmd.StdoutPipe()
 	if err != nil {
-		if verbose {
-			log.Printf("could not get stdout pipe: %v\n", err)
-		}
-		return "", false
+		logger.Debug("could not get stdout pipe", "tag_source", TagFromGoList, "error", err)
+		return "", "", false
 	}
 
 	if err := cmd.Start(); err != nil {
-		if verbose {
-			log.Printf("could not start command: %v\n", err)
-		}
-		return "", false
+		logger.Debug("could not start command", "tag_source", TagFromGoList, "error", err)
+		return "", "", false
 	}
 	defer func() {
 		_ = cmd.Wait()
 	}()
 
-	return parseGoListJSONStream(output, verbose)
+	return parseGoListJSONStream(output, logger)
 }
 
-func parseGoListJSONStream(output io.Reader, verbose bool) (string, bool) {
+// parseGoListJSONStream finds the image version in the output of go list, and
+// returns whether it came from go list or git, see noTagVersion.
+func parseGoListJSONStream(output io.Reader, logger *slog.Logger) (string, string, bool) {
 	decoder := json.NewDecoder(output)
 
 	defer func() {
 		// Consume the rest of the stream
-		if _, err := io.Copy(io.Discard, output); err != nil && verbose {
-			log.Printf("could not discard remaining output: %v\n", err)
+		if _, err := io.Copy(io.Discard, output); err != nil {
+			logger.Debug("could not discard remaining output", "tag_source", TagFromGoList, "error", err)
 		}
 	}()
 
@@ -262,23 +624,15 @@ func parseGoListJSONStream(output io.Reader, verbose bool) (string, bool) {
 			if err == io.EOF {
 				break
 			}
-			if verbose {
-				log.Printf("could not decode module: %v\n", err)
-			}
-			return "", false
+			logger.Debug("could not decode module", "tag_source", TagFromGoList, "error", err)
+			return "", "", false
 		}
 
 		if !strings.Contains(mod.Path, "playwright") {
 			continue
 		}
 
-		if verbose {
-			if mod.Main {
-				log.Printf("Found main module: %s\n", mod.Path)
-			} else {
-				log.Printf("Found module: %s Version: %s\n", mod.Path, mod.Version)
-			}
-		}
+		logger.Debug("found module", "tag_source", TagFromGoList, "path", mod.Path, "version", mod.Version, "main", mod.Main)
 
 		modules[mod.Path] = mod
 	}
@@ -294,49 +648,38 @@ func parseGoListJSONStream(output io.Reader, verbose bool) (string, bool) {
 		mod, exists = modules[playwrightGoArchivedModule]
 	}
 	if exists {
-		if verbose {
-			log.Println("Found playwright-go module:", mod.Path, "Version:", mod.Version)
-		}
+		logger.Debug("found playwright-go module", "tag_source", TagFromGoList, "path", mod.Path, "version", mod.Version)
 		if tag, ok := playwrightGoTagLine(mod.Version); ok {
 			line = tag
 		}
 	}
 
 	if mod, exists := modules[playwrightCIGoModule]; exists {
-		if verbose {
-			log.Println("Found playwright-ci-go module:", mod.Path, "Version:", mod.Version)
-		}
+		logger.Debug("found playwright-ci-go module", "tag_source", TagFromGoList, "path", mod.Path, "version", mod.Version)
 
 		// Developing in this repository: there is no published version of
 		// ourselves to use, so fall back to the line, then to the git tag.
 		if mod.Main {
 			if line != "" {
-				return line, true
+				return line, TagFromGoList, true
 			}
-			return getPlaywrightCIGoGitVersion(verbose)
+			version, found := getPlaywrightCIGoGitVersion(logger)
+			return version, TagFromGit, found
 		}
 
 		if len(mod.Version) > 0 && mod.Version[0] == 'v' {
-			if verbose {
-				log.Println("Using version from go list:", mod.Version)
-			}
-			return mod.Version, true
+			logger.Debug("using version from go list", "tag_source", TagFromGoList, "tag", mod.Version)
+			return mod.Version, TagFromGoList, true
 		}
 
-		if verbose {
-			log.Println("No version found in go list for playwright-ci-go module")
-		}
+		logger.Debug("no version found in go list for playwright-ci-go module", "tag_source", TagFromGoList)
 	}
 
 	if line != "" {
-		if verbose {
-			log.Println("Using release line from playwright-go module:", line)
-		}
-		return line, true
+		logger.Debug("using release line from playwright-go module", "tag_source", TagFromGoList, "tag", line)
+		return line, TagFromGoList, true
 	}
 
-	if verbose {
-		log.Println("No build, module or git info found")
-	}
-	return "", false
+	logger.Debug("no build, module or git info found", "tag_source", TagFromGoList)
+	return "", "", false
 }
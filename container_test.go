@@ -12,7 +12,7 @@ func Test_parseGoListJSONStreamEmpty(t *testing.T) {
 
 	jsonStream := ``
 
-	result, found := parseGoListJSONStream(strings.NewReader(jsonStream), true)
+	result, _, found := parseGoListJSONStream(strings.NewReader(jsonStream), TestLogger(t))
 	assert.False(t, found)
 	assert.Empty(t, result)
 }
@@ -25,7 +25,7 @@ func Test_parseGoListJSONStreamNoPlaywrightCIGo(t *testing.T) {
 	{"Path":"github.com/another/package","Version":"v2.0.0","Main":true}
 	`
 
-	result, found := parseGoListJSONStream(strings.NewReader(jsonStream), true)
+	result, _, found := parseGoListJSONStream(strings.NewReader(jsonStream), TestLogger(t))
 	assert.False(t, found)
 	assert.Empty(t, result)
 }
@@ -38,8 +38,9 @@ func Test_parseGoListJSONStreamPlaywrightCIGoMain(t *testing.T) {
 	`
 
 	// As this call `git` if the command fail, it is possible that the result is not found
-	result, _ := parseGoListJSONStream(strings.NewReader(jsonStream), true)
+	result, source, _ := parseGoListJSONStream(strings.NewReader(jsonStream), TestLogger(t))
 	assert.NotEqual(t, "v1.0.0", result)
+	assert.Equal(t, TagFromGit, source)
 }
 
 func Test_parseGoListJSONStreamPlaywrightCIGoNotMain(t *testing.T) {
@@ -49,9 +50,10 @@ func Test_parseGoListJSONStreamPlaywrightCIGoNotMain(t *testing.T) {
 	{"Path":"github.com/mountain-reverie/playwright-ci-go","Version":"v1.0.0","Main":false}
 	`
 
-	result, found := parseGoListJSONStream(strings.NewReader(jsonStream), true)
+	result, source, found := parseGoListJSONStream(strings.NewReader(jsonStream), TestLogger(t))
 	assert.True(t, found)
 	assert.Equal(t, "v1.0.0", result)
+	assert.Equal(t, TagFromGoList, source)
 }
 
 func Test_parseGoListJSONStreamPlaywrightCIGoNoVersion(t *testing.T) {
@@ -61,7 +63,7 @@ func Test_parseGoListJSONStreamPlaywrightCIGoNoVersion(t *testing.T) {
 	{"Path":"github.com/mountain-reverie/playwright-ci-go","Version":"","Main":false}
 	`
 
-	result, found := parseGoListJSONStream(strings.NewReader(jsonStream), true)
+	result, _, found := parseGoListJSONStream(strings.NewReader(jsonStream), TestLogger(t))
 	assert.False(t, found)
 	assert.Empty(t, result)
 }
@@ -74,7 +76,7 @@ func Test_parseGoListJSONStreamInvalidStream(t *testing.T) {
 	{"Path":"github.com/mountain-reverie/playwright-ci-go","Version":"v1.0.0","Main":false}
 	`
 
-	result, found := parseGoListJSONStream(strings.NewReader(jsonStream), true)
+	result, _, found := parseGoListJSONStream(strings.NewReader(jsonStream), TestLogger(t))
 	assert.False(t, found)
 	assert.Empty(t, result)
 }
@@ -85,14 +87,14 @@ func Test_BuildInfoPath(t *testing.T) {
 	// A test binary of the main module carries no dependency info, so this
 	// resolves nothing here. Consumers of the library do have it, which
 	// TestVersionFromBuildInfo covers against a synthetic BuildInfo.
-	_, ok := getPlaywrightCIGoFromBuildInfo(true)
+	_, ok := getPlaywrightCIGoFromBuildInfo(TestLogger(t))
 	assert.False(t, ok)
 }
 
 func Test_GoListInfo(t *testing.T) {
 	t.Parallel()
 
-	version, ok := getPlaywrightCIGoFromGoList(true)
+	version, _, ok := getPlaywrightCIGoFromGoList(TestLogger(t))
 	assert.True(t, ok)
 	assert.NotEmpty(t, version)
 	assert.Greater(t, len(version), 3)
@@ -102,8 +104,9 @@ func Test_GoListInfo(t *testing.T) {
 func Test_NoTag(t *testing.T) {
 	t.Parallel()
 
-	tag, err := noTagVersion(true)
+	tag, source, err := noTagVersion(TestLogger(t))
 	assert.NoError(t, err)
+	assert.Contains(t, []string{TagFromBuildInfo, TagFromGoList, TagFromGit}, source)
 	assert.Greater(t, len(tag), 3)
 	assert.Equal(t, "v0.", tag[:3])
 }
@@ -1,9 +1,7 @@
 import { firefox } from '@playwright/test';
 
 import { verify } from "./proxy.js";
+import { launch } from "./launch.js";
 verify();
 
-(async () => {
-    const server = await firefox.launchServer({ proxy: { server: process.argv[2] }, headless: true, host: '0.0.0.0', port: 1024 + 1, wsPath: 'firefox' });
-    console.log("ready endpoint:", server.wsEndpoint());
-})();
\ No newline at end of file
+launch(firefox, 'firefox', 1024 + 1);
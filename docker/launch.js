@@ -0,0 +1,36 @@
+// Exit code telling the Go side that the requested channel is not installed
+// in this image, keep in sync with exitChannelUnavailable.
+const exitChannelUnavailable = 3;
+
+// options returns the launchServer options for a browser server: the ones
+// given as JSON by the Go side, merged with the transparent proxy. The port
+// and wsPath given here are defaults the Go side usually overrides.
+export function options(wsPath, port) {
+    const launch = process.argv[4] ? JSON.parse(process.argv[4]) : {};
+
+    return {
+        port,
+        wsPath,
+        ...launch,
+        env: launch.env ? { ...process.env, ...launch.env } : undefined,
+        proxy: { server: process.argv[2] },
+        headless: true,
+        host: '0.0.0.0',
+    };
+}
+
+// launch starts the browser server and reports when it is ready.
+export async function launch(browserType, wsPath, port) {
+    const launchOptions = options(wsPath, port);
+
+    try {
+        const server = await browserType.launchServer(launchOptions);
+        console.log("ready endpoint:", server.wsEndpoint());
+    } catch (err) {
+        console.error(err.message);
+        if (launchOptions.channel && /distribution '.*' is not found/i.test(err.message)) {
+            process.exit(exitChannelUnavailable);
+        }
+        process.exit(1);
+    }
+}
@@ -3,7 +3,9 @@ import * as net from 'net';
 export function verify() {
     const client = new net.Socket();
 
-    const host = 'host.testcontainers.internal';
+    // The proxy is not always reached through host.testcontainers.internal:
+    // a shared container reaches it through the gateway of its network.
+    const host = new URL(process.argv[2]).hostname;
     const port = process.argv[3];
 
     console.log('Connecting to server:', host, port);
@@ -1,9 +1,7 @@
 import { webkit } from '@playwright/test';
 
 import { verify } from "./proxy.js";
+import { launch } from "./launch.js";
 verify();
 
-(async () => {
-    const server = await webkit.launchServer({ proxy: { server: process.argv[2] }, headless: true, host: '0.0.0.0', port: 1024 + 2, wsPath: 'webkit' });
-    console.log("ready endpoint:", server.wsEndpoint());
-})();
\ No newline at end of file
+launch(webkit, 'webkit', 1024 + 2);
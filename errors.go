@@ -0,0 +1,61 @@
+package playwrightcigo
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// ErrChannelUnavailable is wrapped by the *BrowserServerError returned when
+// the requested browser channel, such as "chrome" or "msedge", is not
+// installed in the container image. Those channels need the "channels" image
+// variant, see WithImageVariant.
+var ErrChannelUnavailable = errors.New("browser channel is not installed in the container image")
+
+// ErrRestartBudget is wrapped by the error of a launch needing to relaunch a
+// browser server that died more often than allowed, see WithMaxRestarts.
+var ErrRestartBudget = errors.New("browser server restart budget exhausted")
+
+// errServerGone is the error of a server found not running anymore.
+var errServerGone = errors.New("server process is gone")
+
+// exitChannelUnavailable is the exit code of the container scripts when the
+// requested channel is not installed.
+const exitChannelUnavailable = 3
+
+// BrowserServerError reports that the browser server running in the container
+// (the `node <browser>.js` process) could not be started or exited on its own.
+type BrowserServerError struct {
+	// Browser is the name of the browser whose server failed, e.g. "chromium".
+	Browser string
+	// ExitCode is the exit code of the server process, or -1 when it could not be run.
+	ExitCode int
+	// Output is the combined stdout and stderr of the server process.
+	Output string
+	// Err is the error returned while running the process, if any.
+	Err error
+}
+
+func (e *BrowserServerError) Error() string {
+	if errors.Is(e.Err, ErrChannelUnavailable) {
+		return fmt.Sprintf("%s browser server failed: %v: %s", e.Browser, e.Err, e.Output)
+	}
+	if e.Err != nil {
+		return fmt.Sprintf("%s browser server failed: %v", e.Browser, e.Err)
+	}
+	return fmt.Sprintf("%s browser server exited with code %d: %s", e.Browser, e.ExitCode, e.Output)
+}
+
+func (e *BrowserServerError) Unwrap() error {
+	return e.Err
+}
+
+// report sends an error from a background process to errs without ever
+// blocking that process, logging it when too many are pending.
+func report(logger *slog.Logger, errs chan<- error, err error) {
+	select {
+	case errs <- err:
+	default:
+		logger.Warn("dropping error, too many pending", "error", err)
+	}
+}
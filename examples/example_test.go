@@ -6,17 +6,13 @@ import (
 	"log"
 	"net"
 	"net/http"
-	"os"
 	"testing"
 	"time"
 
 	playwrightcigo "github.com/mountain-reverie/playwright-ci-go"
-	"github.com/mxschmitt/playwright-go"
 	"github.com/stretchr/testify/require"
 )
 
-var browser playwright.Browser
-
 func Test_Firefox(t *testing.T) {
 	l, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
@@ -44,6 +40,10 @@ func Test_Firefox(t *testing.T) {
 	err = playwrightcigo.Wait4Port(base)
 	require.NoError(t, err)
 
+	browser, err := playwrightcigo.Firefox()
+	require.NoError(t, err)
+	defer func() { _ = browser.Close() }()
+
 	page, err := browser.NewPage()
 	require.NoError(t, err)
 
@@ -59,29 +59,34 @@ func Test_Firefox(t *testing.T) {
 	require.NoError(t, err)
 }
 
-func TestMain(m *testing.M) {
-	// Install once Playwright before running tests
-	err := playwrightcigo.Install(playwrightcigo.WithTimeout(time.Minute), playwrightcigo.WithVerbose())
-	if err != nil {
-		log.Fatalf("could not install playwright: %v", err)
-	}
+func Test_FirefoxServe(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("Hello World!"))
+	})
+	// The proxy serves mux in the process: there is no port to open nor to wait for.
+	base := playwrightcigo.Serve(t, mux)
 
-	browser, err = playwrightcigo.Firefox()
-	if err != nil {
-		log.Fatalf("could not instantiate Firefox browser: %v", err)
-	}
+	browser, err := playwrightcigo.Firefox()
+	require.NoError(t, err)
+	defer func() { _ = browser.Close() }()
+
+	page, err := browser.NewPage()
+	require.NoError(t, err)
 
-	exitCode := m.Run()
+	_, err = page.Goto(base)
+	require.NoError(t, err)
 
-	err = browser.Close()
-	if err != nil {
-		log.Fatalf("could not close browser: %v", err)
-	}
+	content, err := page.Content()
+	require.NoError(t, err)
 
-	err = playwrightcigo.Uninstall()
-	if err != nil {
-		log.Fatalf("could not uninstall playwright: %v", err)
-	}
+	require.Contains(t, content, "Hello World!")
 
-	os.Exit(exitCode)
+	err = page.Close()
+	require.NoError(t, err)
+}
+
+func TestMain(m *testing.M) {
+	// Install once Playwright before running tests, and always Uninstall after
+	playwrightcigo.Main(m, playwrightcigo.WithTimeout(time.Minute), playwrightcigo.WithVerbose())
 }
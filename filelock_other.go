@@ -0,0 +1,10 @@
+//go:build !unix
+
+package playwrightcigo
+
+// lockFile does not lock on this platform: the container serializes the
+// processes sharing it on its own, the host lock only spares them some
+// retries.
+func lockFile(path string) (func(), error) {
+	return func() {}, nil
+}
@@ -0,0 +1,489 @@
+package playwrightcigo
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/elazarl/goproxy"
+)
+
+// HARHeader is the request header naming the HAR file a request is recorded
+// in, see WithHARRecording. Set it on a browser context, with its extra HTTP
+// headers, to record the context in a file of its own. The proxy removes it
+// before forwarding the request.
+const HARHeader = "X-Playwright-Ci-Go-Har"
+
+// defaultHARBodyLimit is how much of each body is recorded by default.
+const defaultHARBodyLimit = 1 << 20
+
+// harSessions numbers the sessions of the process recording HAR files.
+var harSessions atomic.Int64
+
+// The types below are the parts of HAR 1.2 the proxy records, see
+// http://www.softwareishard.com/blog/har-12-spec/.
+
+type harFile struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string      `json:"version"`
+	Creator harCreator  `json:"creator"`
+	Entries []*harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// harTrailer ends a HAR file after its last entry. Each entry is written
+// over the trailer of the previous one, so that the file is a valid HAR once
+// any entry is written, even if the process dies before the proxy stops.
+const harTrailer = "\n    ]\n  }\n}\n"
+
+// harRecorder records the requests going through a proxy to HAR files in
+// dir, one for the session, named name, and one per value of HARHeader. Each
+// entry is written once its response completed, and only the entries still
+// waiting for their response are kept in memory.
+type harRecorder struct {
+	dir   string
+	name  string
+	limit int
+
+	mutex sync.Mutex
+	// files holds the files written, by name, and pending the file of each
+	// entry waiting for its response.
+	files   map[string]*harOutput
+	pending map[*harEntry]string
+}
+
+// harOutput is a HAR file being written.
+type harOutput struct {
+	// end is where the trailer starts, and entries how many entries are
+	// written before it.
+	end     int64
+	entries int
+	// err is why the file could not be written: it is not written anymore.
+	err error
+}
+
+// harRecord follows a request from the proxy's request handler to its
+// response handler, in the UserData of the proxy context.
+type harRecord struct {
+	file  string
+	entry *harEntry
+}
+
+// newHARRecorder returns a recorder writing to dir, keeping at most limit
+// bytes of each body.
+func newHARRecorder(dir string, limit int) *harRecorder {
+	return &harRecorder{
+		dir:   dir,
+		name:  fmt.Sprintf("session-%d-%d", os.Getpid(), harSessions.Add(1)),
+		limit: limit,
+
+		files:   map[string]*harOutput{},
+		pending: map[*harEntry]string{},
+	}
+}
+
+// record registers the handlers recording the requests going through proxy.
+// They must be registered first, so that other handlers never see HARHeader.
+func (r *harRecorder) record(proxy *goproxy.ProxyHttpServer) {
+	proxy.OnRequest().DoFunc(func(req *http.Request, ctx *goproxy.ProxyCtx) (*http.Request, *http.Response) {
+		file := r.name
+		if key := req.Header.Get(HARHeader); key != "" {
+			file = key
+			req.Header.Del(HARHeader)
+		}
+
+		entry := &harEntry{
+			StartedDateTime: time.Now(),
+			Request: harRequest{
+				Method:      req.Method,
+				URL:         normalizeURL(req.URL),
+				HTTPVersion: req.Proto,
+				Cookies:     harCookies(req.Cookies()),
+				Headers:     harHeaders(req.Header),
+				QueryString: harQuery(req),
+				HeadersSize: -1,
+				BodySize:    0,
+			},
+		}
+		if req.Body != nil && req.Body != http.NoBody {
+			// Read what is recorded, and give it back to the request.
+			data, _ := io.ReadAll(io.LimitReader(req.Body, int64(r.limit)+1))
+			req.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(data), req.Body), req.Body}
+
+			text, encoding := harText(data[:min(len(data), r.limit)])
+			entry.Request.PostData = &harPostData{
+				MimeType: req.Header.Get("Content-Type"),
+				Text:     text,
+				Encoding: encoding,
+			}
+			entry.Request.BodySize = int(req.ContentLength)
+			if len(data) > r.limit {
+				entry.Request.PostData.Comment = fmt.Sprintf("truncated to %d bytes", r.limit)
+			}
+		}
+
+		ctx.UserData = &harRecord{file: file, entry: entry}
+		return req, nil
+	})
+
+	proxy.OnResponse().DoFunc(func(resp *http.Response, ctx *goproxy.ProxyCtx) *http.Response {
+		record, ok := ctx.UserData.(*harRecord)
+		if !ok {
+			return resp
+		}
+		entry := record.entry
+		wait := time.Since(entry.StartedDateTime)
+
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		entry.Timings.Wait = milliseconds(wait)
+		entry.Time = entry.Timings.Wait
+		if resp == nil {
+			if ctx.Error != nil {
+				entry.Comment = ctx.Error.Error()
+			}
+			r.append(record.file, entry)
+			return resp
+		}
+
+		entry.Response = harResponse{
+			Status:      resp.StatusCode,
+			StatusText:  strings.TrimSpace(strings.TrimPrefix(resp.Status, fmt.Sprint(resp.StatusCode))),
+			HTTPVersion: resp.Proto,
+			Cookies:     harCookies(resp.Cookies()),
+			Headers:     harHeaders(resp.Header),
+			Content:     harContent{MimeType: resp.Header.Get("Content-Type")},
+			RedirectURL: resp.Header.Get("Location"),
+			HeadersSize: -1,
+		}
+		// WebSocket connections keep their body, which goproxy uses as such.
+		if resp.StatusCode == http.StatusSwitchingProtocols || resp.Body == nil {
+			r.append(record.file, entry)
+			return resp
+		}
+		r.pending[entry] = record.file
+		resp.Body = &harBody{ReadCloser: resp.Body, recorder: r, entry: entry, wait: wait}
+		return resp
+	})
+}
+
+// harBody records a response body as the proxy copies it to the browser.
+// goproxy does not close it, so the entry is completed at the end of the body.
+type harBody struct {
+	io.ReadCloser
+	recorder *harRecorder
+	entry    *harEntry
+	wait     time.Duration
+
+	data []byte
+	size int
+	done bool
+}
+
+func (b *harBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.size += n
+	if keep := min(n, b.recorder.limit-len(b.data)); keep > 0 {
+		b.data = append(b.data, p[:keep]...)
+	}
+	if err != nil && !b.done {
+		b.done = true
+		b.complete(err)
+	}
+	return n, err
+}
+
+// complete fills the response body of the entry in.
+func (b *harBody) complete(err error) {
+	b.recorder.mutex.Lock()
+	defer b.recorder.mutex.Unlock()
+
+	content := &b.entry.Response.Content
+	content.Size = b.size
+	content.Text, content.Encoding = harText(b.data)
+	if b.size > len(b.data) {
+		content.Comment = fmt.Sprintf("truncated to %d bytes", len(b.data))
+	}
+	b.entry.Response.BodySize = b.size
+	if !errors.Is(err, io.EOF) {
+		b.entry.Comment = err.Error()
+	}
+
+	b.entry.Timings.Receive = milliseconds(time.Since(b.entry.StartedDateTime) - b.wait)
+	b.entry.Time = b.entry.Timings.Wait + b.entry.Timings.Receive
+
+	if file, ok := b.recorder.pending[b.entry]; ok {
+		delete(b.recorder.pending, b.entry)
+		b.recorder.append(file, b.entry)
+	}
+}
+
+// append writes entry to the HAR file of name, starting the file with its
+// first entry, or without entries when entry is nil. The mutex must be held.
+func (r *harRecorder) append(name string, entry *harEntry) {
+	out, ok := r.files[name]
+	if !ok {
+		out = &harOutput{}
+		r.files[name] = out
+	}
+	if out.err != nil {
+		return
+	}
+	if err := r.write(name, out, entry); err != nil {
+		out.err = err
+	}
+}
+
+// write writes entry over the trailer of out, or starts out when nothing is
+// written yet.
+func (r *harRecorder) write(name string, out *harOutput, entry *harEntry) error {
+	start := out.end == 0
+	var data []byte
+	if start {
+		if err := os.MkdirAll(r.dir, 0o755); err != nil {
+			return fmt.Errorf("could not create HAR directory: %w", err)
+		}
+		head, err := json.MarshalIndent(harFile{Log: harLog{
+			Version: "1.2",
+			Creator: harCreator{Name: "playwright-ci-go", Version: moduleVersion()},
+			Entries: []*harEntry{},
+		}}, "", "  ")
+		if err != nil {
+			return fmt.Errorf("could not encode HAR %s: %w", name, err)
+		}
+		// Entries go between the brackets of the empty list.
+		data = head[:bytes.LastIndex(head, []byte("[]"))+1]
+	}
+	if entry != nil {
+		encoded, err := json.MarshalIndent(entry, "      ", "  ")
+		if err != nil {
+			return fmt.Errorf("could not encode HAR %s: %w", name, err)
+		}
+		if out.entries > 0 {
+			data = append(data, ',')
+		}
+		data = append(data, "\n      "...)
+		data = append(data, encoded...)
+	}
+	data = append(data, harTrailer...)
+
+	flag := os.O_WRONLY
+	if start {
+		flag |= os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(filepath.Join(r.dir, harFileName(name)), flag, 0o644)
+	if err != nil {
+		return fmt.Errorf("could not write HAR: %w", err)
+	}
+	if _, err := f.WriteAt(data, out.end); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("could not write HAR: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("could not write HAR: %w", err)
+	}
+	out.end += int64(len(data) - len(harTrailer))
+	if entry != nil {
+		out.entries++
+	}
+	return nil
+}
+
+// close writes the entries whose response body was not read to the end as
+// they are, and the session's file if no request was recorded to it, then
+// returns why files could not be written.
+func (r *harRecorder) close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	pending := slices.SortedFunc(maps.Keys(r.pending), func(a, b *harEntry) int {
+		return a.StartedDateTime.Compare(b.StartedDateTime)
+	})
+	for _, entry := range pending {
+		r.append(r.pending[entry], entry)
+		delete(r.pending, entry)
+	}
+	if _, ok := r.files[r.name]; !ok {
+		r.append(r.name, nil)
+	}
+
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(r.files)) {
+		errs = append(errs, r.files[name].err)
+	}
+	return errors.Join(errs...)
+}
+
+// unsafeFileName matches what may not appear in the name of a HAR file.
+var unsafeFileName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// harFileName returns the name of the HAR file recording name. Names with
+// unsafe characters, which are replaced, also get a short hash of themselves,
+// so that "a/b" and "a:b" are not recorded to the same file.
+func harFileName(name string) string {
+	file := unsafeFileName.ReplaceAllString(name, "_")
+	if file != name {
+		sum := sha256.Sum256([]byte(name))
+		file += "-" + hex.EncodeToString(sum[:4])
+	}
+	return file + ".har"
+}
+
+// normalizeURL returns u without its fragment nor the default port of its
+// scheme, which requests through HTTPS tunnels have.
+func normalizeURL(u *url.URL) string {
+	n := *u
+	n.Fragment = ""
+	n.RawFragment = ""
+	if host, port, err := net.SplitHostPort(n.Host); err == nil {
+		if (n.Scheme == "http" && port == "80") || (n.Scheme == "https" && port == "443") {
+			n.Host = host
+		}
+	}
+	return n.String()
+}
+
+func harHeaders(header http.Header) []harNameValue {
+	headers := []harNameValue{}
+	for _, name := range slices.Sorted(maps.Keys(header)) {
+		for _, value := range header[name] {
+			headers = append(headers, harNameValue{Name: name, Value: value})
+		}
+	}
+	return headers
+}
+
+func harCookies(cookies []*http.Cookie) []harNameValue {
+	list := []harNameValue{}
+	for _, cookie := range cookies {
+		list = append(list, harNameValue{Name: cookie.Name, Value: cookie.Value})
+	}
+	return list
+}
+
+func harQuery(req *http.Request) []harNameValue {
+	query := []harNameValue{}
+	for name, values := range req.URL.Query() {
+		for _, value := range values {
+			query = append(query, harNameValue{Name: name, Value: value})
+		}
+	}
+	slices.SortStableFunc(query, func(a, b harNameValue) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return query
+}
+
+// harText returns a body as HAR text, base64 encoded unless it is UTF-8.
+func harText(data []byte) (string, string) {
+	if utf8.Valid(data) {
+		return string(data), ""
+	}
+	return base64.StdEncoding.EncodeToString(data), "base64"
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// moduleVersion returns the version of this module in the binary.
+func moduleVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			if dep.Path == playwrightCIGoModule {
+				return dep.Version
+			}
+		}
+	}
+	return "(devel)"
+}
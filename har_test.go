@@ -0,0 +1,201 @@
+package playwrightcigo
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elazarl/goproxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func Test_HARRecording(t *testing.T) {
+	t.Parallel()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The header naming the HAR file does not reach the server.
+		assert.Empty(t, r.Header.Get(HARHeader))
+
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("echo: " + string(body)))
+	}))
+	defer upstream.Close()
+
+	dir := t.TempDir()
+	errs := make(chan error, 1)
+	_, port, close, err := transparentProxy("127.0.0.1", testcontainers.HostInternal, newConfig(WithSleeping(10*time.Millisecond), WithHARRecording(dir), WithHARBodyLimit(8)), errs)
+	require.NoError(t, err)
+
+	client := proxyClient(t, port)
+	resp, err := client.Post(upstream.URL+"/submit?step=1", "text/plain", strings.NewReader("hello"))
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, "echo: hello", string(body))
+
+	// Entries are written as they complete, before the proxy stops.
+	assert.Eventually(t, func() bool {
+		files, err := filepath.Glob(filepath.Join(dir, "session-*.har"))
+		if err != nil || len(files) != 1 {
+			return false
+		}
+		data, err := os.ReadFile(files[0])
+		var har harFile
+		return err == nil && json.Unmarshal(data, &har) == nil && len(har.Log.Entries) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	req, err := http.NewRequest(http.MethodGet, upstream.URL+"/checkout", nil)
+	require.NoError(t, err)
+	req.Header.Set(HARHeader, "checkout flow")
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	_, err = io.Copy(io.Discard, resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+
+	close()
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.har"))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+
+	session := readHAR(t, files[slices.IndexFunc(files, func(f string) bool { return strings.Contains(f, "session-") })])
+	require.Len(t, session.Log.Entries, 1)
+	entry := session.Log.Entries[0]
+	assert.Equal(t, "1.2", session.Log.Version)
+	assert.Equal(t, http.MethodPost, entry.Request.Method)
+	assert.Equal(t, upstream.URL+"/submit?step=1", entry.Request.URL)
+	assert.Equal(t, []harNameValue{{Name: "step", Value: "1"}}, entry.Request.QueryString)
+	assert.Equal(t, "hello", entry.Request.PostData.Text)
+	assert.Equal(t, http.StatusOK, entry.Response.Status)
+	assert.Equal(t, "OK", entry.Response.StatusText)
+	// Bodies are truncated to the limit, keeping their size.
+	assert.Equal(t, "echo: he", entry.Response.Content.Text)
+	assert.Equal(t, len("echo: hello"), entry.Response.Content.Size)
+	assert.Equal(t, "truncated to 8 bytes", entry.Response.Content.Comment)
+
+	checkout := readHAR(t, filepath.Join(dir, harFileName("checkout flow")))
+	require.Len(t, checkout.Log.Entries, 1)
+	assert.Equal(t, upstream.URL+"/checkout", checkout.Log.Entries[0].Request.URL)
+	for _, header := range checkout.Log.Entries[0].Request.Headers {
+		assert.NotEqual(t, HARHeader, header.Name)
+	}
+}
+
+func Test_HARRecordingHTTPS(t *testing.T) {
+	t.Parallel()
+
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("secret"))
+	}))
+	t.Cleanup(upstream.Close)
+
+	// The proxy is built like transparentProxy does, trusting the upstream
+	// server's certificate.
+	dir := t.TempDir()
+	recorder := newHARRecorder(dir, defaultHARBodyLimit)
+	proxy := goproxy.NewProxyHttpServer()
+	proxy.Tr = upstream.Client().Transport.(*http.Transport)
+	recorder.record(proxy)
+	mitm(proxy, func(*http.Request) bool {
+		return true
+	})
+	server := httptest.NewServer(proxy)
+	t.Cleanup(server.Close)
+
+	// The proxy looks into the tunnel, with a certificate of its own, to
+	// record what goes through it.
+	client := proxyClient(t, server.Listener.Addr().(*net.TCPAddr).Port)
+	resp, err := client.Get(upstream.URL + "/secure")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, "secret", string(body))
+	assert.NotEqual(t, upstream.Certificate().Raw, resp.TLS.PeerCertificates[0].Raw)
+	client.CloseIdleConnections()
+
+	require.NoError(t, recorder.close())
+	files, err := filepath.Glob(filepath.Join(dir, "*.har"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	har := readHAR(t, files[0])
+	require.Len(t, har.Log.Entries, 1)
+	assert.Equal(t, upstream.URL+"/secure", har.Log.Entries[0].Request.URL)
+	assert.Equal(t, "secret", har.Log.Entries[0].Response.Content.Text)
+}
+
+func Test_HARRecordingHTTPSOptIn(t *testing.T) {
+	t.Parallel()
+
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("secret"))
+	}))
+	t.Cleanup(upstream.Close)
+
+	dir := t.TempDir()
+	errs := make(chan error, 1)
+	_, port, close, err := transparentProxy("127.0.0.1", testcontainers.HostInternal, newConfig(WithSleeping(10*time.Millisecond), WithHARRecording(dir)), errs)
+	require.NoError(t, err)
+
+	// Without WithHARRecordingHTTPS, the tunnel reaches the server as it is.
+	client := proxyClient(t, port)
+	resp, err := client.Get(upstream.URL + "/secure")
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, upstream.Certificate().Raw, resp.TLS.PeerCertificates[0].Raw)
+	client.CloseIdleConnections()
+
+	require.NoError(t, close())
+	files, err := filepath.Glob(filepath.Join(dir, "*.har"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Empty(t, readHAR(t, files[0]).Log.Entries)
+}
+
+func Test_HARText(t *testing.T) {
+	t.Parallel()
+
+	text, encoding := harText([]byte("héllo"))
+	assert.Equal(t, "héllo", text)
+	assert.Empty(t, encoding)
+
+	text, encoding = harText([]byte{0x89, 'P', 'N', 'G'})
+	assert.Equal(t, "iVBORw==", text)
+	assert.Equal(t, "base64", encoding)
+}
+
+func Test_HARFileName(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "session-1-2.har", harFileName("session-1-2"))
+
+	// Names only differing in their unsafe characters get files of their own.
+	slash, colon := harFileName("a/b"), harFileName("a:b")
+	assert.NotEqual(t, slash, colon)
+	assert.Regexp(t, `^a_b-[0-9a-f]{8}\.har$`, slash)
+	assert.Regexp(t, `^a_b-[0-9a-f]{8}\.har$`, colon)
+}
+
+func readHAR(t *testing.T, path string) harFile {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var har harFile
+	require.NoError(t, json.Unmarshal(data, &har))
+	return har
+}
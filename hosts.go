@@ -0,0 +1,92 @@
+package playwrightcigo
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/elazarl/goproxy"
+)
+
+// hostMapping resolves the hosts matching pattern, a hostname or a wildcard
+// such as "*.app.test", to target, see WithHostMapping.
+type hostMapping struct {
+	pattern string
+	target  string
+}
+
+// matches reports whether host matches the pattern of the mapping. A
+// wildcard matches the subdomains of its domain, not the domain itself.
+func (m hostMapping) matches(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if domain, ok := strings.CutPrefix(m.pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+domain)
+	}
+	return host == m.pattern
+}
+
+// mapHost returns the address to dial instead of addr, a host and port, and
+// whether a mapping matched it. The first mapping matching wins. A target
+// without port keeps the port of addr.
+func mapHost(mappings []hostMapping, addr string) (string, bool) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host, port = addr, ""
+	}
+	for _, m := range mappings {
+		if !m.matches(host) {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(m.target); err == nil || port == "" {
+			return m.target, true
+		}
+		return net.JoinHostPort(m.target, port), true
+	}
+	return addr, false
+}
+
+// mapHosts makes proxy connect to the targets of mappings instead of the hosts
+// they match. Requests are left as they are, so servers get the Host header
+// the browser sent, and HTTPS tunnels are mapped too.
+func mapHosts(proxy *goproxy.ProxyHttpServer, mappings []hostMapping, c *config) {
+	dial := proxy.Tr.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	proxy.Tr.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if target, ok := mapHost(mappings, addr); ok {
+			c.logger.Debug("mapping host", "addr", addr, "target", target)
+			addr = target
+		}
+		return dial(ctx, network, addr)
+	}
+
+	// Mapped hosts are reached directly, whatever proxy the environment sets:
+	// goproxy tunnels through HTTPS_PROXY with ConnectDial, and requests go
+	// through the proxy of its transport.
+	if connectDial := proxy.ConnectDial; connectDial != nil {
+		proxy.ConnectDial = func(network, addr string) (net.Conn, error) {
+			if _, ok := mapHost(mappings, addr); ok {
+				return proxy.Tr.DialContext(context.Background(), network, addr)
+			}
+			return connectDial(network, addr)
+		}
+	}
+	if connectDial := proxy.ConnectDialWithReq; connectDial != nil {
+		proxy.ConnectDialWithReq = func(req *http.Request, network, addr string) (net.Conn, error) {
+			if _, ok := mapHost(mappings, addr); ok {
+				return proxy.Tr.DialContext(req.Context(), network, addr)
+			}
+			return connectDial(req, network, addr)
+		}
+	}
+	upstream := proxy.Tr.Proxy
+	proxy.Tr.Proxy = func(req *http.Request) (*url.URL, error) {
+		if _, ok := mapHost(mappings, req.URL.Host); ok || upstream == nil {
+			return nil, nil
+		}
+		return upstream(req)
+	}
+}
@@ -0,0 +1,102 @@
+package playwrightcigo
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func Test_MapHost(t *testing.T) {
+	t.Parallel()
+
+	mappings := []hostMapping{
+		{pattern: "app.test", target: "127.0.0.1:8080"},
+		{pattern: "*.app.test", target: "127.0.0.1:8081"},
+		{pattern: "cdn.test", target: "10.0.0.1"},
+	}
+	tests := []struct {
+		addr   string
+		target string
+		ok     bool
+	}{
+		{addr: "app.test:80", target: "127.0.0.1:8080", ok: true},
+		{addr: "APP.test:80", target: "127.0.0.1:8080", ok: true},
+		{addr: "acme.app.test:443", target: "127.0.0.1:8081", ok: true},
+		{addr: "a.b.app.test:80", target: "127.0.0.1:8081", ok: true},
+		{addr: "cdn.test:8443", target: "10.0.0.1:8443", ok: true},
+		{addr: "cdn.test", target: "10.0.0.1", ok: true},
+		{addr: "notapp.test:80", target: "notapp.test:80", ok: false},
+		{addr: "example.com:80", target: "example.com:80", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			t.Parallel()
+
+			target, ok := mapHost(mappings, tt.addr)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.target, target)
+		})
+	}
+}
+
+func Test_HostMapping(t *testing.T) {
+	t.Parallel()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hello " + r.Host))
+	}))
+	defer upstream.Close()
+	addr := strings.TrimPrefix(upstream.URL, "http://")
+
+	errs := make(chan error, 1)
+	c := newConfig(WithSleeping(10*time.Millisecond), WithHostMapping("app.test", addr), WithHostMapping("*.app.test", addr))
+	_, port, close, err := transparentProxy("127.0.0.1", testcontainers.HostInternal, c, errs)
+	require.NoError(t, err)
+	defer close()
+	client := proxyClient(t, port)
+
+	for _, host := range []string{"app.test", "acme.app.test"} {
+		resp, err := client.Get("http://" + host + "/")
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		// The server gets the Host header the browser sent.
+		assert.Equal(t, "hello "+host, string(body))
+	}
+}
+
+func Test_HostMappingHTTPSProxy(t *testing.T) {
+	// Mapped hosts must not go through the proxies of the environment, which
+	// goproxy reads when it is created.
+	t.Setenv("HTTP_PROXY", "http://127.0.0.1:1")
+	t.Setenv("HTTPS_PROXY", "http://127.0.0.1:1")
+
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hello " + r.Host))
+	}))
+	defer upstream.Close()
+	addr := strings.TrimPrefix(upstream.URL, "https://")
+
+	errs := make(chan error, 1)
+	c := newConfig(WithSleeping(10*time.Millisecond), WithHostMapping("app.test", addr))
+	_, port, close, err := transparentProxy("127.0.0.1", testcontainers.HostInternal, c, errs)
+	require.NoError(t, err)
+	defer close()
+
+	resp, err := proxyClient(t, port).Get("https://app.test/")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "hello app.test", string(body))
+}
@@ -1,7 +1,7 @@
 package playwrightcigo
 
 import (
-	"log"
+	"log/slog"
 	"runtime/debug"
 	"strings"
 )
@@ -40,7 +40,7 @@ func playwrightGoTagLine(version string) (string, bool) {
 // versionFromBuildInfo resolves the image tag from the versions the Go
 // toolchain recorded in the binary, needing neither the network nor the go
 // command at run time.
-func versionFromBuildInfo(info *debug.BuildInfo, verbose bool) (string, bool) {
+func versionFromBuildInfo(info *debug.BuildInfo, logger *slog.Logger) (string, bool) {
 	if info == nil {
 		return "", false
 	}
@@ -53,9 +53,7 @@ func versionFromBuildInfo(info *debug.BuildInfo, verbose bool) (string, bool) {
 			// Our own pinned version *is* the image tag, so it beats
 			// anything we could derive.
 			if len(dep.Version) > 0 && dep.Version[0] == 'v' {
-				if verbose {
-					log.Println("Using playwright-ci-go version from build info:", dep.Version)
-				}
+				logger.Debug("using playwright-ci-go version from build info", "tag_source", TagFromBuildInfo, "tag", dep.Version)
 				return dep.Version, true
 			}
 		case playwrightGoModule, playwrightGoArchivedModule:
@@ -64,9 +62,7 @@ func versionFromBuildInfo(info *debug.BuildInfo, verbose bool) (string, bool) {
 	}
 
 	if tag, ok := playwrightGoTagLine(playwrightGo); ok {
-		if verbose {
-			log.Println("Using release line from playwright-go version", playwrightGo, "->", tag)
-		}
+		logger.Debug("using release line from playwright-go version", "tag_source", TagFromBuildInfo, "playwright_go", playwrightGo, "tag", tag)
 		return tag, true
 	}
 
@@ -105,7 +105,7 @@ func TestVersionFromBuildInfo(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			t.Parallel()
 
-			got, ok := versionFromBuildInfo(test.info, true)
+			got, ok := versionFromBuildInfo(test.info, TestLogger(t))
 			assert.Equal(t, test.ok, ok)
 			assert.Equal(t, test.want, got)
 		})
@@ -4,17 +4,19 @@ package playwrightcigo
 
 import (
 	"fmt"
-	"log"
 	"sync"
-
-	"github.com/containerd/errdefs"
-	"github.com/mxschmitt/playwright-go"
 )
 
-var pw *playwright.Playwright
-var browsers *container
+// session is the default Session, shared by Install, Uninstall and the
+// package-level browser functions.
+var session *Session
 var count = 0
 
+// stopSignals removes the signal handler of the default session, if any, see
+// WithSignalHandler. interrupted is set once a signal tore the session down.
+var stopSignals func()
+var interrupted bool
+
 var mutex sync.Mutex
 
 // Install sets up the containerized Playwright environment.
@@ -33,29 +35,15 @@ func Install(opts ...Option) error {
 		return nil
 	}
 
-	c := config{}
-	for _, opt := range opts {
-		opt.apply(&c)
-	}
-
-	driver, err := playwright.NewDriver(&playwright.RunOptions{SkipInstallBrowsers: true, Verbose: c.verbose})
-	if err != nil {
-		return fmt.Errorf("error while setting up driver: %w", err)
-	}
-
-	if err := driver.Install(); err != nil {
-		return fmt.Errorf("error while installing driver: %w", err)
-	}
-
-	pw, err = playwright.Run()
-	if err != nil {
-		return fmt.Errorf("error while starting to run playwright: %w", err)
-	}
-
-	browsers, err = new(opts...)
+	s, err := New(opts...)
 	if err != nil {
 		return err
 	}
+	session = s
+	interrupted = false
+	if s.config.signals > 0 {
+		stopSignals = handleSignals(s.config.signals)
+	}
 
 	count++
 	return nil
@@ -68,31 +56,36 @@ func Install(opts ...Option) error {
 func Uninstall() error {
 	mutex.Lock()
 	defer mutex.Unlock()
+
+	if count == 0 {
+		if interrupted {
+			// A signal already tore the session down.
+			return nil
+		}
+		return fmt.Errorf("playwright-ci-go is not installed")
+	}
+
 	count--
 	if count > 0 {
 		return nil
 	}
 
-	for chromium.count > 0 {
-		chromium.cancel()
-	}
-	for firefox.count > 0 {
-		firefox.cancel()
-	}
-	for webkit.count > 0 {
-		webkit.cancel()
+	if stopSignals != nil {
+		stopSignals()
+		stopSignals = nil
 	}
+	s := session
+	session = nil
+	return s.Close()
+}
 
-	if err := browsers.Close(); err != nil {
-		// Ignore "not found" errors since the container may have already been terminated due to timeout or other cleanup.
-		if !errdefs.IsNotFound(err) {
-			return fmt.Errorf("could not close container: %w", err)
-		}
-		log.Println("container already closed or not found, ignoring error:", err)
-	}
+// defaultSession returns the session created by Install.
+func defaultSession() (*Session, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
 
-	if err := pw.Stop(); err != nil {
-		return fmt.Errorf("could not stop playwright: %w", err)
+	if session == nil {
+		return nil, fmt.Errorf("container is not running")
 	}
-	return nil
+	return session, nil
 }
@@ -0,0 +1,247 @@
+package playwrightcigo
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/elazarl/goproxy"
+)
+
+// Proxy holds the Go handlers of the requests the browsers of a session send
+// through its transparent proxy, whatever the browser and context, to stub
+// backends or look at the traffic from tests.
+//
+// The proxy looks into the HTTPS tunnels to the hosts the handlers may apply
+// to, with a certificate of its own, which browser contexts must accept with
+// their IgnoreHttpsErrors option. To tell, matchers are given the CONNECT
+// request opening the tunnel, whose URL only has the scheme https and the
+// host: Host and URLGlob match it on the host, URLRegexp and handlers without
+// matchers look into every tunnel.
+//
+// Handlers may be registered and removed while the session runs. They are
+// called on the goroutine of the request, several of them concurrently.
+type Proxy struct {
+	mutex     sync.RWMutex
+	requests  []*RequestHook
+	responses []*ResponseHook
+}
+
+// RequestMatcher selects the requests a hook applies to.
+type RequestMatcher func(req *http.Request) bool
+
+// URLGlob matches the requests whose URL matches pattern, where * matches any
+// characters but /, and ** any characters. The URL has no default port, for
+// instance "http://app.test/api/**".
+func URLGlob(pattern string) RequestMatcher {
+	match := URLRegexp(glob(pattern))
+
+	// Tunnels are matched on the scheme and host of the pattern, or all of
+	// them when it does not start with those.
+	origin := regexp.MustCompile(".*")
+	if i := strings.Index(pattern, "://"); i >= 0 {
+		if j := strings.IndexByte(pattern[i+len("://"):], '/'); j >= 0 {
+			origin = glob(pattern[:i+len("://")+j])
+		} else {
+			origin = glob(pattern)
+		}
+	}
+	return func(req *http.Request) bool {
+		if req.Method == http.MethodConnect {
+			return origin.MatchString(normalizeURL(&url.URL{Scheme: "https", Host: req.URL.Host}))
+		}
+		return match(req)
+	}
+}
+
+// glob compiles a pattern of URLGlob.
+func glob(pattern string) *regexp.Regexp {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(pattern); {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**"):
+			expr.WriteString(".*")
+			i += 2
+		case pattern[i] == '*':
+			expr.WriteString("[^/]*")
+			i++
+		default:
+			end := i + strings.IndexByte(pattern[i:]+"*", '*')
+			expr.WriteString(regexp.QuoteMeta(pattern[i:end]))
+			i = end
+		}
+	}
+	expr.WriteString("$")
+	return regexp.MustCompile(expr.String())
+}
+
+// URLRegexp matches the requests whose URL, without default port, matches re.
+func URLRegexp(re *regexp.Regexp) RequestMatcher {
+	return func(req *http.Request) bool {
+		if req.Method == http.MethodConnect {
+			return true
+		}
+		return re.MatchString(normalizeURL(req.URL))
+	}
+}
+
+// Host matches the requests to one of hosts, given with or without port.
+func Host(hosts ...string) RequestMatcher {
+	return func(req *http.Request) bool {
+		return slices.Contains(hosts, req.URL.Host) || slices.Contains(hosts, req.URL.Hostname())
+	}
+}
+
+// RequestHook handles the requests matching all its matchers, see
+// Proxy.OnRequest.
+type RequestHook struct {
+	proxy    *Proxy
+	matchers []RequestMatcher
+	handler  func(*http.Request) (*http.Request, *http.Response)
+}
+
+// ResponseHook handles the responses to the requests matching all its
+// matchers, see Proxy.OnResponse.
+type ResponseHook struct {
+	proxy    *Proxy
+	matchers []RequestMatcher
+	handler  func(*http.Response) *http.Response
+}
+
+// OnRequest returns a hook for the requests matching all of matchers, or all
+// requests without matchers. Its handler is set with Do.
+func (p *Proxy) OnRequest(matchers ...RequestMatcher) *RequestHook {
+	return &RequestHook{proxy: p, matchers: matchers}
+}
+
+// OnResponse returns a hook for the responses to the requests matching all of
+// matchers, or all requests without matchers. Its handler is set with Do.
+func (p *Proxy) OnResponse(matchers ...RequestMatcher) *ResponseHook {
+	return &ResponseHook{proxy: p, matchers: matchers}
+}
+
+// Do registers handler for the requests of the hook. It may return the
+// request, modified or not, to forward it, or a response to answer it without
+// reaching the server, such as one built with goproxy.NewResponse. Handlers
+// are called in the order they were registered, until one answers.
+// Do returns a function removing the handler.
+func (h *RequestHook) Do(handler func(*http.Request) (*http.Request, *http.Response)) func() {
+	hook := &RequestHook{proxy: h.proxy, matchers: h.matchers, handler: handler}
+	p := h.proxy
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.requests = append(p.requests, hook)
+	return func() {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		p.requests = slices.DeleteFunc(p.requests, func(r *RequestHook) bool { return r == hook })
+	}
+}
+
+// Handle answers the requests of the hook with handler, as if it was their
+// server, streaming its responses. It returns a function removing the handler.
+func (h *RequestHook) Handle(handler http.Handler) func() {
+	return h.Do(func(req *http.Request) (*http.Request, *http.Response) {
+		return req, serveInProcess(handler, req)
+	})
+}
+
+// Do registers handler for the responses of the hook. It returns the
+// response given to the browser, which may be the one it got, modified or
+// not. Handlers are called in the order they were registered, and are not
+// called when no response could be obtained. Do returns a function removing
+// the handler.
+func (h *ResponseHook) Do(handler func(*http.Response) *http.Response) func() {
+	hook := &ResponseHook{proxy: h.proxy, matchers: h.matchers, handler: handler}
+	p := h.proxy
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.responses = append(p.responses, hook)
+	return func() {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		p.responses = slices.DeleteFunc(p.responses, func(r *ResponseHook) bool { return r == hook })
+	}
+}
+
+// matches reports whether req matches all of matchers.
+func matches(matchers []RequestMatcher, req *http.Request) bool {
+	for _, match := range matchers {
+		if !match(req) {
+			return false
+		}
+	}
+	return true
+}
+
+// tunnels reports whether the hooks of p may apply to the requests going
+// through the HTTPS tunnel connect opens, see Proxy.
+func (p *Proxy) tunnels(connect *http.Request) bool {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	for _, hook := range p.requests {
+		if matches(hook.matchers, connect) {
+			return true
+		}
+	}
+	for _, hook := range p.responses {
+		if matches(hook.matchers, connect) {
+			return true
+		}
+	}
+	return false
+}
+
+// intercept registers the handlers calling the hooks of p on proxy.
+func (p *Proxy) intercept(proxy *goproxy.ProxyHttpServer) {
+	proxy.OnRequest().DoFunc(func(req *http.Request, _ *goproxy.ProxyCtx) (*http.Request, *http.Response) {
+		p.mutex.RLock()
+		hooks := slices.Clone(p.requests)
+		p.mutex.RUnlock()
+
+		for _, hook := range hooks {
+			if !matches(hook.matchers, req) {
+				continue
+			}
+			var resp *http.Response
+			if req, resp = hook.handler(req); resp != nil {
+				return req, resp
+			}
+		}
+		return req, nil
+	})
+
+	proxy.OnResponse().DoFunc(func(resp *http.Response, ctx *goproxy.ProxyCtx) *http.Response {
+		p.mutex.RLock()
+		hooks := slices.Clone(p.responses)
+		p.mutex.RUnlock()
+
+		for _, hook := range hooks {
+			if resp != nil && matches(hook.matchers, ctx.Req) {
+				resp = hook.handler(resp)
+			}
+		}
+		return resp
+	})
+}
+
+// CurrentProxy returns the hooks of the proxy of the default session.
+func CurrentProxy() (*Proxy, error) {
+	s, err := defaultSession()
+	if err != nil {
+		return nil, err
+	}
+	return s.Proxy(), nil
+}
+
+// Proxy returns the hooks of the proxy the browsers of the session go through.
+func (s *Session) Proxy() *Proxy {
+	return s.config.proxy
+}
@@ -0,0 +1,157 @@
+package playwrightcigo
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/elazarl/goproxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func Test_Matchers(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		matcher RequestMatcher
+		method  string
+		url     string
+		want    bool
+	}{
+		{name: "glob", matcher: URLGlob("http://app.test/api/*"), url: "http://app.test/api/users", want: true},
+		{name: "glob stops at slash", matcher: URLGlob("http://app.test/api/*"), url: "http://app.test/api/users/1", want: false},
+		{name: "glob double star", matcher: URLGlob("http://app.test/**"), url: "http://app.test/api/users/1?page=2", want: true},
+		{name: "glob literal", matcher: URLGlob("http://app.test/a.js"), url: "http://app.test/abjs", want: false},
+		{name: "glob default port", matcher: URLGlob("http://app.test/"), url: "http://app.test:80/", want: true},
+		{name: "regexp", matcher: URLRegexp(regexp.MustCompile(`/users/\d+$`)), url: "http://app.test/users/42", want: true},
+		{name: "regexp no match", matcher: URLRegexp(regexp.MustCompile(`/users/\d+$`)), url: "http://app.test/users/me", want: false},
+		{name: "host", matcher: Host("cdn.test"), url: "http://cdn.test:8080/lib.js", want: true},
+		{name: "host with port", matcher: Host("cdn.test:8080"), url: "http://cdn.test:8080/lib.js", want: true},
+		{name: "other host", matcher: Host("cdn.test"), url: "http://app.test/", want: false},
+		{name: "glob tunnel", matcher: URLGlob("https://app.test/api/**"), method: http.MethodConnect, url: "app.test:443", want: true},
+		{name: "glob wildcard tunnel", matcher: URLGlob("https://*.app.test/**"), method: http.MethodConnect, url: "eu.app.test:443", want: true},
+		{name: "glob other tunnel", matcher: URLGlob("https://app.test/**"), method: http.MethodConnect, url: "cdn.test:443", want: false},
+		{name: "glob plain HTTP", matcher: URLGlob("http://app.test/**"), method: http.MethodConnect, url: "app.test:443", want: false},
+		{name: "glob any tunnel", matcher: URLGlob("**/api/**"), method: http.MethodConnect, url: "app.test:443", want: true},
+		{name: "regexp tunnel", matcher: URLRegexp(regexp.MustCompile(`/users/\d+$`)), method: http.MethodConnect, url: "app.test:443", want: true},
+		{name: "host tunnel", matcher: Host("cdn.test"), method: http.MethodConnect, url: "cdn.test:443", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, tt.url, nil)
+			assert.Equal(t, tt.want, tt.matcher(req))
+		})
+	}
+}
+
+func Test_Intercept(t *testing.T) {
+	t.Parallel()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("upstream " + r.Header.Get("X-Test")))
+	}))
+	defer upstream.Close()
+
+	stub := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		_, _ = w.Write([]byte("stub " + r.URL.Path))
+	})
+	c := newConfig(WithSleeping(10*time.Millisecond), WithProxyHandler(stub, Host("api.test")))
+	errs := make(chan error, 1)
+	_, port, close, err := transparentProxy("127.0.0.1", testcontainers.HostInternal, c, errs)
+	require.NoError(t, err)
+	defer close()
+	client := proxyClient(t, port)
+
+	get := func(url string) (int, string) {
+		t.Helper()
+		resp, err := client.Get(url)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(body)
+	}
+
+	status, body := get("http://api.test/users")
+	assert.Equal(t, http.StatusTeapot, status)
+	assert.Equal(t, "stub /users", body)
+
+	// Hooks are registered while the proxy runs, and removed.
+	removeRequest := c.proxy.OnRequest(URLGlob(upstream.URL + "/**")).Do(func(req *http.Request) (*http.Request, *http.Response) {
+		req.Header.Set("X-Test", "modified")
+		return req, nil
+	})
+	removeResponse := c.proxy.OnResponse(URLGlob(upstream.URL + "/**")).Do(func(resp *http.Response) *http.Response {
+		resp.Header.Set("X-Intercepted", "yes")
+		return resp
+	})
+	resp, err := client.Get(upstream.URL + "/page")
+	require.NoError(t, err)
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, "upstream modified", string(data))
+	assert.Equal(t, "yes", resp.Header.Get("X-Intercepted"))
+
+	removeRequest()
+	removeResponse()
+	status, body = get(upstream.URL + "/page")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "upstream ", body)
+
+	// The first handler answering wins.
+	remove := c.proxy.OnRequest(URLRegexp(regexp.MustCompile(`/blocked$`))).Do(func(req *http.Request) (*http.Request, *http.Response) {
+		return req, goproxy.NewResponse(req, goproxy.ContentTypeText, http.StatusForbidden, "blocked")
+	})
+	defer remove()
+	status, body = get(upstream.URL + "/blocked")
+	assert.Equal(t, http.StatusForbidden, status)
+	assert.Equal(t, "blocked", body)
+	status, _ = get("http://api.test/blocked")
+	assert.Equal(t, http.StatusTeapot, status)
+}
+
+func Test_InterceptHTTPS(t *testing.T) {
+	t.Parallel()
+
+	stub := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("stub " + r.URL.Path))
+	})
+	c := newConfig(WithSleeping(10*time.Millisecond), WithProxyHandler(stub, URLGlob("https://api.test/v1/**")))
+	errs := make(chan error, 1)
+	_, port, close, err := transparentProxy("127.0.0.1", testcontainers.HostInternal, c, errs)
+	require.NoError(t, err)
+	defer close()
+	client := proxyClient(t, port)
+	defer client.CloseIdleConnections()
+
+	// The proxy looks into the tunnels to the hosts the handlers target...
+	resp, err := client.Get("https://api.test/v1/users")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, "stub /v1/users", string(body))
+	assert.Equal(t, "api.test", resp.TLS.PeerCertificates[0].Subject.CommonName)
+
+	// ...and to those of the handlers registered since, but not to others.
+	connect := httptest.NewRequest(http.MethodConnect, "cdn.test:443", nil)
+	assert.False(t, c.proxy.tunnels(connect))
+	remove := c.proxy.OnResponse(Host("cdn.test")).Do(func(resp *http.Response) *http.Response { return resp })
+	assert.True(t, c.proxy.tunnels(connect))
+	remove()
+	assert.False(t, c.proxy.tunnels(connect))
+}
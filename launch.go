@@ -0,0 +1,221 @@
+package playwrightcigo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"time"
+
+	"github.com/mxschmitt/playwright-go"
+)
+
+// LaunchOptions configures the browser server launched in the container.
+// The fields mirror the options of Playwright's browserType.launchServer;
+// the proxy is always set to the transparent proxy and the browser always
+// runs headless.
+//
+// Browsers launched with the same name and options share one server, while
+// distinct options get a server of their own.
+type LaunchOptions struct {
+	// Channel selects a browser distribution for Chromium: "chromium" (new
+	// headless mode), "chromium-headless-shell" (Playwright's default),
+	// or branded ones such as "chrome", "chrome-beta", "msedge". Branded
+	// channels are only installed in the "channels" image variant.
+	Channel string
+	// Args are additional arguments to pass to the browser instance.
+	Args []string
+	// IgnoreDefaultArgs filters out the given default arguments Playwright
+	// passes to the browser.
+	IgnoreDefaultArgs []string
+	// IgnoreAllDefaultArgs stops Playwright from passing any of its default
+	// arguments to the browser. Dangerous, use with care.
+	IgnoreAllDefaultArgs bool
+	// FirefoxUserPrefs are Firefox user preferences, see about:config.
+	FirefoxUserPrefs map[string]any
+	// Env holds environment variables visible to the browser, on top of the
+	// ones of the server process.
+	Env map[string]string
+	// Timeout is the maximum time to wait for the browser instance to start.
+	// Playwright's default is 30 seconds.
+	Timeout time.Duration
+	// SlowMo slows down Playwright operations by the given duration. It only
+	// affects this connection, not the server.
+	SlowMo time.Duration
+	// Dedicated launches a server of its own for this browser, instead of
+	// sharing the one of the launches with the same options. Its port comes
+	// from the pool, see WithPortPool.
+	Dedicated bool
+}
+
+// LaunchOption configures a browser launch.
+// A LaunchOptions value is itself a LaunchOption: its slices and maps are
+// added to the ones already set, and its non-zero scalars replace them.
+type LaunchOption interface {
+	applyLaunch(*LaunchOptions)
+}
+
+var _ LaunchOption = LaunchOptions{}
+
+func (o LaunchOptions) applyLaunch(l *LaunchOptions) {
+	if o.Channel != "" {
+		l.Channel = o.Channel
+	}
+	l.Args = append(l.Args, o.Args...)
+	l.IgnoreDefaultArgs = append(l.IgnoreDefaultArgs, o.IgnoreDefaultArgs...)
+	if o.IgnoreAllDefaultArgs {
+		l.IgnoreAllDefaultArgs = true
+	}
+	if len(o.FirefoxUserPrefs) > 0 {
+		if l.FirefoxUserPrefs == nil {
+			l.FirefoxUserPrefs = map[string]any{}
+		}
+		maps.Copy(l.FirefoxUserPrefs, o.FirefoxUserPrefs)
+	}
+	if len(o.Env) > 0 {
+		if l.Env == nil {
+			l.Env = map[string]string{}
+		}
+		maps.Copy(l.Env, o.Env)
+	}
+	if o.Timeout > 0 {
+		l.Timeout = o.Timeout
+	}
+	if o.SlowMo > 0 {
+		l.SlowMo = o.SlowMo
+	}
+	if o.Dedicated {
+		l.Dedicated = true
+	}
+}
+
+var _ LaunchOption = (*launchOptionFunc)(nil)
+
+type launchOptionFunc func(*LaunchOptions)
+
+func (f launchOptionFunc) applyLaunch(o *LaunchOptions) {
+	f(o)
+}
+
+// WithChannel launches the given Chromium distribution, see LaunchOptions.Channel.
+//
+//	browser, err := playwrightcigo.Launch("chromium", playwrightcigo.WithChannel("chrome"))
+//
+// Branded channels need an image built with them, which WithImageVariant("channels")
+// selects. When the image lacks the channel, the launch fails with an error
+// wrapping ErrChannelUnavailable.
+func WithChannel(channel string) LaunchOption {
+	return launchOptionFunc(func(o *LaunchOptions) {
+		o.Channel = channel
+	})
+}
+
+// WithDedicatedServer launches the browser on a server of its own, see
+// LaunchOptions.Dedicated. This lets several independent servers of the same
+// browser run side by side in the container.
+func WithDedicatedServer() LaunchOption {
+	return launchOptionFunc(func(o *LaunchOptions) {
+		o.Dedicated = true
+	})
+}
+
+// launchServerOptions is the JSON handed to the container scripts, which
+// pass it on to launchServer after setting the proxy.
+type launchServerOptions struct {
+	Channel           string            `json:"channel,omitempty"`
+	Args              []string          `json:"args,omitempty"`
+	IgnoreDefaultArgs any               `json:"ignoreDefaultArgs,omitempty"`
+	FirefoxUserPrefs  map[string]any    `json:"firefoxUserPrefs,omitempty"`
+	Env               map[string]string `json:"env,omitempty"`
+	Timeout           int64             `json:"timeout,omitempty"`
+	Port              int               `json:"port,omitempty"`
+	WSPath            string            `json:"wsPath,omitempty"`
+}
+
+// server returns the launchServer options for a server listening on port and
+// wsPath, or on the script's defaults when they are zero.
+func (o LaunchOptions) server(port int, wsPath string) ([]byte, error) {
+	s := launchServerOptions{
+		Channel:          o.Channel,
+		Args:             o.Args,
+		FirefoxUserPrefs: o.FirefoxUserPrefs,
+		Env:              o.Env,
+		Timeout:          o.Timeout.Milliseconds(),
+		Port:             port,
+		WSPath:           wsPath,
+	}
+	if o.IgnoreAllDefaultArgs {
+		s.IgnoreDefaultArgs = true
+	} else if len(o.IgnoreDefaultArgs) > 0 {
+		s.IgnoreDefaultArgs = o.IgnoreDefaultArgs
+	}
+
+	return json.Marshal(s)
+}
+
+// key identifies the server a browser launched with these options runs on.
+func (o LaunchOptions) key(name string) (string, error) {
+	// Maps are marshalled with sorted keys, so equal options give equal keys.
+	s, err := o.server(0, "")
+	if err != nil {
+		return "", fmt.Errorf("invalid launch options for %s: %w", name, err)
+	}
+	return name + " " + string(s), nil
+}
+
+// isDefault reports whether the options are the default ones, those of
+// Chromium, Firefox and Webkit.
+func (o LaunchOptions) isDefault() bool {
+	s, err := o.server(0, "")
+	return err == nil && string(s) == "{}"
+}
+
+// Launch launches a browser of the given name ("chromium", "firefox",
+// "webkit" or one added with RegisterBrowser) in the container, configured by opts, and returns a browser
+// object like Chromium, Firefox and Webkit do.
+//
+// Launches with the same name and options share a server, so for instance
+// Launch("chromium") is the same as Chromium(). Launches with distinct
+// options, or with WithDedicatedServer, run distinct servers.
+func Launch(name string, opts ...LaunchOption) (playwright.Browser, error) {
+	return LaunchContext(context.Background(), name, opts...)
+}
+
+// LaunchContext is like Launch, but ctx bounds the launch: starting the
+// server, mapping its port and connecting to it. If ctx expires first, the
+// returned error wraps ctx.Err().
+func LaunchContext(ctx context.Context, name string, opts ...LaunchOption) (playwright.Browser, error) {
+	s, err := defaultSession()
+	if err != nil {
+		return nil, err
+	}
+	return s.LaunchContext(ctx, name, opts...)
+}
+
+// Launch launches a browser in the session's container.
+// See the package-level Launch for details.
+func (s *Session) Launch(name string, opts ...LaunchOption) (playwright.Browser, error) {
+	return s.LaunchContext(context.Background(), name, opts...)
+}
+
+// LaunchContext launches a browser in the session's container.
+// See the package-level LaunchContext for details.
+func (s *Session) LaunchContext(ctx context.Context, name string, opts ...LaunchOption) (playwright.Browser, error) {
+	o := LaunchOptions{}
+	for _, opt := range opts {
+		opt.applyLaunch(&o)
+	}
+
+	// The lock is only held to pick the server: starting it and connecting
+	// to it may take a while, which other launches do not wait for.
+	s.mutexBrowser.Lock()
+	b, err := s.server(name, o)
+	if err == nil {
+		b.reserve()
+	}
+	s.mutexBrowser.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return b.connect(ctx)
+}
@@ -0,0 +1,270 @@
+package playwrightcigo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mxschmitt/playwright-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_LaunchOptionsServer(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		options LaunchOptions
+		port    int
+		wsPath  string
+		want    string
+	}{
+		{"default", LaunchOptions{}, 0, "", `{}`},
+		{"port and path", LaunchOptions{}, 1027, "chromium", `{"port":1027,"wsPath":"chromium"}`},
+		{"slowMo stays on the Go side", LaunchOptions{SlowMo: time.Second}, 0, "", `{}`},
+		{"args", LaunchOptions{Args: []string{"--lang=fr"}}, 0, "", `{"args":["--lang=fr"]}`},
+		{"ignore some default args", LaunchOptions{IgnoreDefaultArgs: []string{"--mute-audio"}}, 0, "", `{"ignoreDefaultArgs":["--mute-audio"]}`},
+		{"ignore all default args", LaunchOptions{IgnoreDefaultArgs: []string{"--mute-audio"}, IgnoreAllDefaultArgs: true}, 0, "", `{"ignoreDefaultArgs":true}`},
+		{"firefox prefs", LaunchOptions{FirefoxUserPrefs: map[string]any{"b": 1, "a": true}}, 0, "", `{"firefoxUserPrefs":{"a":true,"b":1}}`},
+		{"env and timeout", LaunchOptions{Env: map[string]string{"DEBUG": "pw:*"}, Timeout: 3 * time.Second}, 0, "", `{"env":{"DEBUG":"pw:*"},"timeout":3000}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := test.options.server(test.port, test.wsPath)
+			require.NoError(t, err)
+			assert.JSONEq(t, test.want, string(got))
+		})
+	}
+}
+
+func Test_LaunchOptionsMerge(t *testing.T) {
+	t.Parallel()
+
+	o := LaunchOptions{}
+	for _, opt := range []LaunchOption{
+		LaunchOptions{Args: []string{"--a"}, Env: map[string]string{"A": "1"}, Timeout: time.Second},
+		LaunchOptions{Args: []string{"--b"}, Env: map[string]string{"B": "2"}, SlowMo: time.Millisecond},
+	} {
+		opt.applyLaunch(&o)
+	}
+
+	assert.Equal(t, LaunchOptions{
+		Args:    []string{"--a", "--b"},
+		Env:     map[string]string{"A": "1", "B": "2"},
+		Timeout: time.Second,
+		SlowMo:  time.Millisecond,
+	}, o)
+}
+
+func Test_SessionServers(t *testing.T) {
+	t.Parallel()
+
+	s := &Session{specs: registered()}
+
+	chromium, err := s.server("chromium", LaunchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, s.specs["chromium"].Port, chromium.instancePort)
+
+	// Options that only matter to the connection share the server.
+	slow, err := s.server("chromium", LaunchOptions{SlowMo: time.Second})
+	require.NoError(t, err)
+	assert.Same(t, chromium, slow)
+
+	// Distinct options get a distinct server on a port of their own.
+	french, err := s.server("chromium", LaunchOptions{Args: []string{"--lang=fr"}})
+	require.NoError(t, err)
+	assert.NotSame(t, chromium, french)
+	assert.Equal(t, portPoolBase, french.instancePort)
+
+	again, err := s.server("chromium", LaunchOptions{Args: []string{"--lang=fr"}})
+	require.NoError(t, err)
+	assert.Same(t, french, again)
+
+	german, err := s.server("firefox", LaunchOptions{Args: []string{"--lang=de"}})
+	require.NoError(t, err)
+	assert.Equal(t, portPoolBase+1, german.instancePort)
+
+	_, err = s.server("lynx", LaunchOptions{})
+	assert.ErrorContains(t, err, "unknown browser")
+}
+
+func Test_LaunchChannel(t *testing.T) {
+	t.Parallel()
+
+	o := LaunchOptions{}
+	WithChannel("chrome").applyLaunch(&o)
+	assert.Equal(t, "chrome", o.Channel)
+
+	got, err := o.server(0, "")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"channel":"chrome"}`, string(got))
+
+	// Each channel is a server of its own.
+	s := &Session{specs: registered()}
+	chrome, err := s.server("chromium", o)
+	require.NoError(t, err)
+	chromium, err := s.server("chromium", LaunchOptions{})
+	require.NoError(t, err)
+	assert.NotSame(t, chrome, chromium)
+
+	_, err = s.Launch("firefox", WithChannel("chrome"))
+	assert.ErrorContains(t, err, "only supported by chromium")
+}
+
+func Test_SessionDedicatedServers(t *testing.T) {
+	t.Parallel()
+
+	s := &Session{specs: registered(), config: newConfig(WithPortPool(2))}
+
+	shared, err := s.server("firefox", LaunchOptions{})
+	require.NoError(t, err)
+
+	first, err := s.server("firefox", LaunchOptions{Dedicated: true})
+	require.NoError(t, err)
+	assert.NotSame(t, shared, first)
+	assert.Equal(t, portPoolBase, first.instancePort)
+
+	second, err := s.server("firefox", LaunchOptions{Dedicated: true})
+	require.NoError(t, err)
+	assert.NotSame(t, first, second)
+	assert.Equal(t, portPoolBase+1, second.instancePort)
+
+	_, err = s.server("firefox", LaunchOptions{Dedicated: true})
+	assert.ErrorContains(t, err, "all 2 ports of the pool are in use")
+
+	// A stopped server gives its port back to the pool.
+	s.release(first)
+	third, err := s.server("firefox", LaunchOptions{Dedicated: true})
+	require.NoError(t, err)
+	assert.Equal(t, portPoolBase, third.instancePort)
+}
+
+// fakeBrowser stands for a browser connected to a server.
+type fakeBrowser struct {
+	playwright.Browser
+	closed       int
+	disconnected []func(playwright.Browser)
+}
+
+func (f *fakeBrowser) OnDisconnected(handler func(playwright.Browser)) {
+	f.disconnected = append(f.disconnected, handler)
+}
+
+// disconnect runs the handlers as a dropped connection does.
+func (f *fakeBrowser) disconnect() {
+	for _, handler := range f.disconnected {
+		handler(f)
+	}
+}
+
+func (f *fakeBrowser) Close(...playwright.BrowserCloseOptions) error {
+	f.closed++
+	f.disconnect()
+	return nil
+}
+
+func Test_LaunchedClose(t *testing.T) {
+	t.Parallel()
+
+	s := &Session{specs: registered(), config: newConfig(WithIdleTimeout(10 * time.Millisecond))}
+	stopped := map[string]int{}
+
+	s.mutexBrowser.Lock()
+	shared, err := s.server("firefox", LaunchOptions{})
+	require.NoError(t, err)
+	shared.stop = func() { stopped["shared"]++ }
+	dedicated, err := s.server("firefox", LaunchOptions{Dedicated: true})
+	require.NoError(t, err)
+	dedicated.stop = func() { stopped["dedicated"]++ }
+
+	fake := &fakeBrowser{}
+	shared.count = 2
+	first, second := shared.track(fake, 0), shared.track(fake, 0)
+	dedicated.count = 1
+	third := dedicated.track(fake, 0)
+
+	leaks := s.leaks()
+	s.mutexBrowser.Unlock()
+	require.Len(t, leaks, 3)
+	assert.Contains(t, leaks[0], "firefox launched at ")
+	assert.Contains(t, leaks[0], "launch_test.go:")
+
+	// A dedicated server stops with its browser.
+	require.NoError(t, third.Close())
+	assert.Equal(t, 1, stopped["dedicated"])
+
+	// A shared one once unused for the idle timeout, however often its
+	// browsers are closed.
+	require.NoError(t, first.Close())
+	require.NoError(t, first.Close())
+	assert.Equal(t, 3, fake.closed)
+	require.NoError(t, second.Close())
+	assert.Eventually(t, func() bool {
+		s.mutexBrowser.Lock()
+		defer s.mutexBrowser.Unlock()
+		return stopped["shared"] == 1
+	}, time.Second, 10*time.Millisecond)
+
+	s.mutexBrowser.Lock()
+	defer s.mutexBrowser.Unlock()
+	assert.Empty(t, s.leaks())
+	assert.Empty(t, s.servers)
+	assert.Empty(t, s.ports)
+}
+
+func Test_LaunchedDisconnected(t *testing.T) {
+	t.Parallel()
+
+	s := &Session{specs: registered()}
+	s.mutexBrowser.Lock()
+	b, err := s.server("firefox", LaunchOptions{})
+	require.NoError(t, err)
+	b.stop = func() {}
+	b.count = 2
+	dropped := &fakeBrowser{}
+	closed := b.track(&fakeBrowser{}, 0)
+	b.track(dropped, 0)
+	s.mutexBrowser.Unlock()
+
+	// Closing a browser does not make its server suspect...
+	require.NoError(t, closed.Close())
+	s.mutexBrowser.Lock()
+	assert.False(t, b.suspect)
+	s.mutexBrowser.Unlock()
+
+	// ...while a dropped connection does.
+	dropped.disconnect()
+	assert.Eventually(t, func() bool {
+		s.mutexBrowser.Lock()
+		defer s.mutexBrowser.Unlock()
+		return b.suspect
+	}, time.Second, time.Millisecond)
+}
+
+func Test_SessionSharedServers(t *testing.T) {
+	t.Parallel()
+
+	s := &Session{specs: registered(), shared: true, slot: 2}
+	s.mutexBrowser.Lock()
+	defer s.mutexBrowser.Unlock()
+
+	// Other processes use the default ports and the other slots.
+	b, err := s.server("firefox", LaunchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, portPoolBase+2*reuseSlotPorts, b.instancePort)
+
+	for range reuseSlotPorts - 1 {
+		_, err = s.server("firefox", LaunchOptions{Dedicated: true})
+		require.NoError(t, err)
+	}
+	_, err = s.server("firefox", LaunchOptions{Dedicated: true})
+	assert.ErrorContains(t, err, "all 16 ports of the pool are in use")
+	assert.Len(t, s.ports, reuseSlotPorts)
+	for port := range s.ports {
+		assert.GreaterOrEqual(t, port, portPoolBase+2*reuseSlotPorts)
+		assert.Less(t, port, portPoolBase+3*reuseSlotPorts)
+	}
+}
@@ -0,0 +1,181 @@
+package playwrightcigo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	tcexec "github.com/testcontainers/testcontainers-go/exec"
+)
+
+// The processes using a container hold leases on it, which they renew while
+// alive: the container stops on its own once no lease is left, rather than
+// after a fixed time, so neither a long suite loses it nor a crashed process
+// leaves it behind.
+//
+// leaseDir holds the leases: lock serializes their changes, slots has a file
+// per process holding the time its lease expires at, and closing marks a
+// container about to stop.
+const leaseDir = "/tmp/playwright-ci-go"
+
+// lifetime is the command of the container, keeping leases in $1. It keeps
+// running as long as leases are held, and for $2 seconds after the last one
+// was given back or expired. Leases are first taken $2 seconds after the
+// start at the latest.
+const lifetime = `dir=$1
+rm -rf "$dir" && mkdir -p "$dir/slots"
+while sleep 1; do
+	flock "$dir/lock" sh -c '
+		now=$(date +%s)
+		for f in "$0"/slots/*; do
+			[ -e "$f" ] && [ "$(cat "$f")" -lt "$now" ] && rm -f "$f"
+		done
+		if [ -z "$(ls "$0/slots")" ] && [ $((now - $(stat -c %Y "$0/slots"))) -ge "$1" ]; then
+			touch "$0/closing"
+		fi' "$dir" "$2"
+	[ -e "$dir/closing" ] && exit 0
+done`
+
+// leaseTake takes the lease of the first free of $2 slots until $1, and
+// prints the slot.
+const leaseTake = `flock "$0/lock" sh -c '
+	[ -e "$0/closing" ] && exit 5
+	for i in $(seq 0 $(($2 - 1))); do
+		if [ ! -e "$0/slots/$i" ]; then
+			echo "$1" > "$0/slots/$i"
+			echo "$i"
+			exit 0
+		fi
+	done
+	exit 6' "$0" "$1" "$2"`
+
+// leaseRenew extends the lease of slot $1 until $2, unless it expired.
+const leaseRenew = `flock "$0/lock" sh -c '[ -e "$0" ] && echo "$1" > "$0"' "$0/slots/$1" "$2"`
+
+// leaseReclaim stops the servers whose pid files are given, first asking
+// nicely for 5 seconds then killing them, see container.stop.
+const leaseReclaim = `pids=""
+for f in "$@"; do
+	pid=$(cat "$f" 2>/dev/null) && kill "$pid" 2>/dev/null && pids="$pids $pid"
+	rm -f "$f"
+done
+for i in $(seq 50); do
+	alive=""
+	for pid in $pids; do
+		kill -0 "$pid" 2>/dev/null && alive="$alive $pid"
+	done
+	pids=$alive
+	[ -z "$pids" ] && exit 0
+	sleep 0.1
+done
+kill -9 $pids 2>/dev/null
+exit 0`
+
+// errClosing is returned when a container is about to stop.
+var errClosing = errors.New("browser container is stopping")
+
+// errNoSlot is returned when a container has no lease left to take.
+var errNoSlot = errors.New("all slots of the browser container are in use")
+
+// attach takes a lease on the container, in the first free of slots, and
+// keeps renewing it until the container is closed. The lease expires ttl after
+// the last renewal, which is reported to errs.
+func (c *container) attach(ctx context.Context, slots int, ttl time.Duration, errs chan<- error) error {
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	cmd := []string{"sh", "-c", leaseTake, leaseDir, expires, strconv.Itoa(slots)}
+	code, output, err := c.browsers.Exec(ctx, cmd, tcexec.Multiplexed())
+	if err != nil {
+		return fmt.Errorf("could not take a lease on browser container: %w", err)
+	}
+	switch code {
+	case 0:
+	case 5:
+		return errClosing
+	case 6:
+		return fmt.Errorf("%w: %d processes use it", errNoSlot, slots)
+	default:
+		return fmt.Errorf("could not take a lease on browser container: exited with code %d", code)
+	}
+
+	out, err := io.ReadAll(output)
+	if err != nil {
+		return fmt.Errorf("could not read lease on browser container: %w", err)
+	}
+	c.slot, err = strconv.Atoi(strings.TrimSpace(string(out)))
+	if err != nil {
+		return fmt.Errorf("invalid lease on browser container %q: %w", out, err)
+	}
+
+	go c.renew(ttl, errs)
+	return nil
+}
+
+// renew renews the lease of this process every third of ttl until the
+// container is closed.
+func (c *container) renew(ttl time.Duration, errs chan<- error) {
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.context.Done():
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(c.context, ttl/3)
+		expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+		cmd := []string{"sh", "-c", leaseRenew, leaseDir, strconv.Itoa(c.slot), expires}
+		code, _, err := c.browsers.Exec(ctx, cmd)
+		cancel()
+
+		switch {
+		case c.context.Err() != nil:
+			return
+		case err != nil:
+			// The next renewal may go through, in time.
+			c.log.Warn("could not renew lease on browser container", "slot", c.slot, "error", err)
+		case code != 0:
+			report(c.log, errs, fmt.Errorf("lease on browser container expired, it is stopping"))
+			return
+		}
+	}
+}
+
+// reclaim stops the servers listening on the count ports from first, which a
+// process whose lease expired left behind in the slot this process took: they
+// would keep the ports taken, and answer for a proxy that is gone.
+func (c *container) reclaim(ctx context.Context, first, count int) error {
+	cmd := []string{"sh", "-c", leaseReclaim, "reclaim"}
+	for port := first; port < first+count; port++ {
+		cmd = append(cmd, pidFile(port))
+	}
+	code, _, err := c.browsers.Exec(ctx, cmd)
+	if err != nil {
+		return fmt.Errorf("could not stop the servers left in browser container: %w", err)
+	}
+	if code != 0 {
+		return fmt.Errorf("could not stop the servers left in browser container: exited with code %d", code)
+	}
+	return nil
+}
+
+// detach gives the lease of this process back.
+func (c *container) detach() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	slot := fmt.Sprintf("%s/slots/%d", leaseDir, c.slot)
+	code, _, err := c.browsers.Exec(ctx, []string{"flock", leaseDir + "/lock", "rm", "-f", slot})
+	if err != nil {
+		return fmt.Errorf("could not give lease on browser container back: %w", err)
+	}
+	if code != 0 {
+		return fmt.Errorf("could not give lease on browser container back: exited with code %d", code)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package playwrightcigo
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_LeaseScripts(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("flock"); err != nil {
+		t.Skip("flock is not available:", err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "leases")
+	lifetime := exec.Command("sh", "-c", lifetime, "playwright-ci-go", dir, "1")
+	require.NoError(t, lifetime.Start())
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(dir, "slots"))
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	take := func(expires time.Time) (string, int) {
+		out, err := exec.Command("sh", "-c", leaseTake, dir, strconv.FormatInt(expires.Unix(), 10), "2").Output()
+		var exit *exec.ExitError
+		if errors.As(err, &exit) {
+			return "", exit.ExitCode()
+		}
+		require.NoError(t, err)
+		return string(out), 0
+	}
+	renew := func(slot string) int {
+		err := exec.Command("sh", "-c", leaseRenew, dir, slot, strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)).Run()
+		var exit *exec.ExitError
+		if errors.As(err, &exit) {
+			return exit.ExitCode()
+		}
+		require.NoError(t, err)
+		return 0
+	}
+
+	// Two slots are handed out, then none is left.
+	slot, code := take(time.Now().Add(time.Hour))
+	assert.Equal(t, "0\n", slot)
+	assert.Zero(t, code)
+	slot, code = take(time.Now().Add(-time.Second))
+	assert.Equal(t, "1\n", slot)
+	assert.Zero(t, code)
+	_, code = take(time.Now().Add(time.Hour))
+	assert.Equal(t, 6, code)
+
+	// A lease not renewed in time expires.
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(dir, "slots", "1"))
+		return os.IsNotExist(err)
+	}, 5*time.Second, 100*time.Millisecond)
+	assert.Equal(t, 1, renew("1"))
+	assert.Zero(t, renew("0"))
+
+	// Without leases, the container stops.
+	require.NoError(t, os.Remove(filepath.Join(dir, "slots", "0")))
+	require.NoError(t, lifetime.Wait())
+	_, code = take(time.Now().Add(time.Hour))
+	assert.Equal(t, 5, code)
+}
+
+func Test_LeaseReclaim(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	left := exec.Command("sleep", "60")
+	require.NoError(t, left.Start())
+	exited := make(chan error, 1)
+	go func() {
+		exited <- left.Wait()
+	}()
+	server := filepath.Join(dir, "1040.pid")
+	require.NoError(t, os.WriteFile(server, []byte(strconv.Itoa(left.Process.Pid)), 0o644))
+	// The server of another pid file already exited.
+	gone := filepath.Join(dir, "1041.pid")
+	require.NoError(t, os.WriteFile(gone, []byte("999999999"), 0o644))
+
+	require.NoError(t, exec.Command("sh", "-c", leaseReclaim, "reclaim", server, gone, filepath.Join(dir, "1042.pid")).Run())
+	assert.Error(t, <-exited)
+	assert.NoFileExists(t, server)
+	assert.NoFileExists(t, gone)
+}
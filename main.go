@@ -0,0 +1,71 @@
+package playwrightcigo
+
+import (
+	"log/slog"
+	"os"
+	"sync"
+	"testing"
+)
+
+// Main is a ready-made TestMain: it calls Install with the provided options,
+// runs the tests, always calls Uninstall and exits with the tests' exit code.
+// A failed Install or Uninstall is logged, see WithLogger, and turns a
+// passing run into a failing one.
+//
+// Main tears down on SIGINT and SIGTERM too, as with WithSignalHandler, which
+// the options may give a timeout other than 10 seconds with.
+//
+// A test that panics kills the process from its own goroutine, so Uninstall
+// does not run then: the testcontainers reaper, and the container once the
+// lease of the process expired, see WithLease, clean up after it.
+//
+//	func TestMain(m *testing.M) {
+//		playwrightcigo.Main(m, playwrightcigo.WithTimeout(time.Minute))
+//	}
+func Main(m *testing.M, opts ...Option) {
+	opts = mainOptions(opts)
+	logger := newConfig(opts...).logger
+	os.Exit(run(m, func() error { return Install(opts...) }, Uninstall, logger))
+}
+
+// mainOptions returns the options Main installs with: the signal handler,
+// then opts.
+func mainOptions(opts []Option) []Option {
+	return append([]Option{WithSignalHandler(defaultSignalTimeout)}, opts...)
+}
+
+// run implements Main with the given install and uninstall functions, logging
+// their failures to logger, and returns the exit code instead of exiting.
+func run(m interface{ Run() int }, install, uninstall func() error, logger *slog.Logger) (code int) {
+	if err := install(); err != nil {
+		logger.Error("could not install playwright-ci-go", "error", err)
+		return 1
+	}
+
+	var once sync.Once
+	var teardownErr error
+	teardown := func() error {
+		once.Do(func() {
+			teardownErr = uninstall()
+			if teardownErr != nil {
+				logger.Error("could not uninstall playwright-ci-go", "error", teardownErr)
+			}
+		})
+		return teardownErr
+	}
+
+	// Only catches the panics of m.Run itself, not those of the tests.
+	defer func() {
+		if r := recover(); r != nil {
+			_ = teardown()
+			panic(r)
+		}
+	}()
+
+	code = m.Run()
+
+	if err := teardown(); err != nil && code == 0 {
+		code = 1
+	}
+	return code
+}
@@ -0,0 +1,68 @@
+package playwrightcigo
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeM runs tests by calling run, recording the calls in calls.
+type fakeM struct {
+	calls *[]string
+	run   func() int
+}
+
+func (m fakeM) Run() int {
+	*m.calls = append(*m.calls, "run")
+	return m.run()
+}
+
+func Test_Run(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		installErr   error
+		code         int
+		panics       bool
+		uninstallErr error
+		want         int
+		calls        []string
+	}{
+		{name: "pass", code: 0, want: 0, calls: []string{"install", "run", "uninstall"}},
+		{name: "fail", code: 3, want: 3, calls: []string{"install", "run", "uninstall"}},
+		{name: "uninstall fails", uninstallErr: errors.New("boom"), want: 1, calls: []string{"install", "run", "uninstall"}},
+		{name: "uninstall fails after failed tests", code: 2, uninstallErr: errors.New("boom"), want: 2, calls: []string{"install", "run", "uninstall"}},
+		{name: "install fails", installErr: errors.New("no docker"), want: 1, calls: []string{"install"}},
+		{name: "panic", panics: true, calls: []string{"install", "run", "uninstall"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			calls := []string{}
+			m := fakeM{calls: &calls, run: func() int {
+				if tt.panics {
+					panic("test panicked")
+				}
+				return tt.code
+			}}
+			install := func() error {
+				calls = append(calls, "install")
+				return tt.installErr
+			}
+			uninstall := func() error {
+				calls = append(calls, "uninstall")
+				return tt.uninstallErr
+			}
+
+			if tt.panics {
+				assert.PanicsWithValue(t, "test panicked", func() { run(m, install, uninstall, TestLogger(t)) })
+			} else {
+				assert.Equal(t, tt.want, run(m, install, uninstall, TestLogger(t)))
+			}
+			assert.Equal(t, tt.calls, calls)
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package playwrightcigo
+
+import (
+	"net/http"
+)
+
+// Observer is notified of what a session does: starting and stopping its
+// container and browser servers, the requests of the browsers going through
+// its proxy and the retries while waiting for a port. It lets telemetry and
+// artifact collection plug into the library, see WithObserver.
+//
+// Callbacks run on the goroutine of the event, several of them concurrently,
+// so they must be safe for concurrent use and return quickly. Embed
+// NopObserver to implement only some of them.
+type Observer interface {
+	// ContainerStarting is called before the container of image is started,
+	// or attached to when shared, see WithReuse. ContainerStarted is called
+	// once it runs with its ID, or with the error that kept it from running.
+	ContainerStarting(image string)
+	ContainerStarted(image, id string, err error)
+	// ContainerStopped is called once the session is done with the
+	// container: it terminated it or, when shared, detached from it.
+	ContainerStopped(id string, err error)
+
+	// BrowserLaunching is called before a server of browser is started on
+	// the container port. BrowserLaunched is called once it is ready with
+	// its WebSocket URL, or with the error that kept it from starting.
+	BrowserLaunching(browser string, port int)
+	BrowserLaunched(browser string, port int, uri string, err error)
+	// BrowserExited is called when a server that was ready exits: err is nil
+	// when it was stopped, and a *BrowserServerError when it died.
+	BrowserExited(browser string, port int, err error)
+
+	// ProxyRequest is called when the proxy receives a request from a
+	// browser, ProxyResponse once it got the response of the upstream
+	// server, or the error that kept it from getting one. They must not
+	// modify the request or the response, nor read the body. HTTPS requests
+	// are only seen when the proxy looks into their tunnels, to record or
+	// replay them for instance.
+	ProxyRequest(req *http.Request)
+	ProxyResponse(req *http.Request, resp *http.Response, err error)
+
+	// WaitRetry is called by Wait4Port each time addr could not be reached
+	// and is about to be tried again.
+	WaitRetry(addr string, attempt int, err error)
+}
+
+// NopObserver implements Observer with callbacks doing nothing.
+type NopObserver struct{}
+
+var _ Observer = NopObserver{}
+
+func (NopObserver) ContainerStarting(string)                           {}
+func (NopObserver) ContainerStarted(string, string, error)             {}
+func (NopObserver) ContainerStopped(string, error)                     {}
+func (NopObserver) BrowserLaunching(string, int)                       {}
+func (NopObserver) BrowserLaunched(string, int, string, error)         {}
+func (NopObserver) BrowserExited(string, int, error)                   {}
+func (NopObserver) ProxyRequest(*http.Request)                         {}
+func (NopObserver) ProxyResponse(*http.Request, *http.Response, error) {}
+func (NopObserver) WaitRetry(string, int, error)                       {}
+
+// observers notifies each of its observers in turn.
+type observers []Observer
+
+var _ Observer = observers(nil)
+
+func (obs observers) ContainerStarting(image string) {
+	for _, o := range obs {
+		o.ContainerStarting(image)
+	}
+}
+
+func (obs observers) ContainerStarted(image, id string, err error) {
+	for _, o := range obs {
+		o.ContainerStarted(image, id, err)
+	}
+}
+
+func (obs observers) ContainerStopped(id string, err error) {
+	for _, o := range obs {
+		o.ContainerStopped(id, err)
+	}
+}
+
+func (obs observers) BrowserLaunching(browser string, port int) {
+	for _, o := range obs {
+		o.BrowserLaunching(browser, port)
+	}
+}
+
+func (obs observers) BrowserLaunched(browser string, port int, uri string, err error) {
+	for _, o := range obs {
+		o.BrowserLaunched(browser, port, uri, err)
+	}
+}
+
+func (obs observers) BrowserExited(browser string, port int, err error) {
+	for _, o := range obs {
+		o.BrowserExited(browser, port, err)
+	}
+}
+
+func (obs observers) ProxyRequest(req *http.Request) {
+	for _, o := range obs {
+		o.ProxyRequest(req)
+	}
+}
+
+func (obs observers) ProxyResponse(req *http.Request, resp *http.Response, err error) {
+	for _, o := range obs {
+		o.ProxyResponse(req, resp, err)
+	}
+}
+
+func (obs observers) WaitRetry(addr string, attempt int, err error) {
+	for _, o := range obs {
+		o.WaitRetry(addr, attempt, err)
+	}
+}
@@ -0,0 +1,126 @@
+package playwrightcigo
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+// recorder is an Observer recording the events it is notified of.
+type recorder struct {
+	NopObserver
+
+	mutex  sync.Mutex
+	events []string
+}
+
+func (r *recorder) record(format string, args ...any) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.events = append(r.events, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) recorded() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]string{}, r.events...)
+}
+
+func (r *recorder) ContainerStarted(_, _ string, err error) {
+	r.record("container started %v", err)
+}
+
+func (r *recorder) ContainerStopped(_ string, err error) {
+	r.record("container stopped %v", err)
+}
+
+func (r *recorder) BrowserLaunched(browser string, _ int, _ string, err error) {
+	r.record("%s launched %v", browser, err)
+}
+
+func (r *recorder) BrowserExited(browser string, _ int, err error) {
+	r.record("%s exited %v", browser, err)
+}
+
+func (r *recorder) ProxyRequest(req *http.Request) {
+	r.record("request %s %s", req.Method, req.URL.Path)
+}
+
+func (r *recorder) ProxyResponse(req *http.Request, resp *http.Response, err error) {
+	// There is no response on error.
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	r.record("response %s %d %t", req.URL.Path, status, err != nil)
+}
+
+func (r *recorder) WaitRetry(_ string, attempt int, err error) {
+	r.record("retry %d %t", attempt, err != nil)
+}
+
+func Test_ObserverWaitRetry(t *testing.T) {
+	t.Parallel()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := "http://" + l.Addr().String()
+	require.NoError(t, l.Close())
+
+	observer := &recorder{}
+	err = Wait4Port(addr, WithRetry(3), WithSleeping(time.Millisecond), WithObserver(observer))
+	assert.Error(t, err)
+	assert.Equal(t, []string{"retry 1 true", "retry 2 true", "retry 3 true"}, observer.recorded())
+}
+
+func Test_ObserverProxy(t *testing.T) {
+	t.Parallel()
+
+	observer := &recorder{}
+	errs := make(chan error, 1)
+	_, port, close, err := transparentProxy("127.0.0.1", testcontainers.HostInternal, newConfig(WithSleeping(10*time.Millisecond), WithObserver(observer)), errs)
+	require.NoError(t, err)
+	defer close()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer upstream.Close()
+
+	resp, err := proxyClient(t, port).Get(upstream.URL + "/tea")
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+
+	assert.Equal(t, []string{"request GET /tea", "response /tea 418 false"}, observer.recorded())
+}
+
+func Test_ObserverProxyError(t *testing.T) {
+	t.Parallel()
+
+	observer := &recorder{}
+	errs := make(chan error, 1)
+	_, port, close, err := transparentProxy("127.0.0.1", testcontainers.HostInternal, newConfig(WithSleeping(10*time.Millisecond), WithObserver(observer)), errs)
+	require.NoError(t, err)
+	defer close()
+
+	// Nothing listens upstream anymore.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	resp, err := proxyClient(t, port).Get("http://" + addr + "/tea")
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+
+	assert.Equal(t, []string{"request GET /tea", "response /tea 0 true"}, observer.recorded())
+}
@@ -2,6 +2,11 @@ package playwrightcigo
 
 import (
 	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
 	"time"
 )
 
@@ -26,7 +31,9 @@ func WithContext(ctx context.Context) Option {
 	})
 }
 
-// WithTimeout sets the timeout of the container.
+// WithTimeout sets the timeout for starting the container, pulling its
+// image included. Once started, the container runs as long as the session,
+// see WithLease.
 // The default timeout is 5 minutes.
 func WithTimeout(timeout time.Duration) Option {
 	return optionFunc(func(c *config) {
@@ -68,8 +75,264 @@ func WithRepository(repository, tag string) Option {
 	})
 }
 
+// defaultPortPool is the number of container ports in the pool by default.
+const defaultPortPool = 16
+
+// WithPortPool sets how many container ports are exposed for browser servers
+// beside the default one of each browser: servers with custom launch options
+// and dedicated servers each take one. The default is 16, and at most 256.
+func WithPortPool(size int) Option {
+	return optionFunc(func(c *config) {
+		if size > 0 {
+			c.portPool = min(size, maxPortPool)
+		}
+	})
+}
+
+// defaultMaxRestarts is how many times a browser server is relaunched by default.
+const defaultMaxRestarts = 3
+
+// WithMaxRestarts sets how many times each browser server is relaunched after
+// dying, for instance when it crashed or was OOM-killed. The relaunch happens
+// on the next launch of that browser; once the budget is spent, launches fail
+// with an error wrapping ErrRestartBudget. The default is 3, and 0 disables
+// relaunching.
+func WithMaxRestarts(count int) Option {
+	return optionFunc(func(c *config) {
+		if count >= 0 {
+			c.restarts = count
+		}
+	})
+}
+
+// defaultIdleTimeout is how long an unused browser server keeps running by default.
+const defaultIdleTimeout = 30 * time.Second
+
+// WithIdleTimeout sets how long a browser server keeps running once the last
+// browser connected to it is closed, so that the next launch can reuse it.
+// The default is 30 seconds, and 0 stops servers right away. Dedicated
+// servers, which no launch reuses, always stop right away.
+// It also sets how long a container shared with WithReuse keeps running once
+// the last process detached from it, at least as long as the lease (see
+// WithLease).
+func WithIdleTimeout(timeout time.Duration) Option {
+	return optionFunc(func(c *config) {
+		if timeout >= 0 {
+			c.idle = timeout
+		}
+	})
+}
+
+// defaultLease is how long the lease of a session on its container lasts by default.
+const defaultLease = 30 * time.Second
+
+// WithLease sets how long the container keeps running without hearing from
+// the session. The session renews its lease every third of that time while
+// it is alive, so the container neither stops under a long suite nor
+// outlives a crashed or killed test binary by more than about twice the
+// lease. The default is 30 seconds, and the minimum 3 seconds.
+func WithLease(ttl time.Duration) Option {
+	return optionFunc(func(c *config) {
+		if ttl >= 3*time.Second {
+			c.lease = ttl
+		}
+	})
+}
+
+// WithReuse shares the browser container between the processes of the host
+// using the same name, such as the test binaries of the packages run by
+// "go test ./...", instead of starting one per process.
+//
+// The first process starts the container, the next ones attach to it, and it
+// stops once the last one detached and the idle timeout (see WithIdleTimeout)
+// elapsed. A process that did not detach, because it crashed for instance, is
+// forgotten once its lease expires, see WithLease. Each process still runs its own
+// browser servers and proxy, on 16 ports of its own: WithPortPool has no
+// effect. Up to 8 processes share a container; the next ones start their own.
+func WithReuse(name string) Option {
+	return optionFunc(func(c *config) {
+		c.reuse = name
+	})
+}
+
+// WithImageVariant selects a variant of the container image, published as
+// "<tag>-<variant>". The "channels" variant adds the branded Chrome and
+// Edge channels (linux/amd64 only), see WithChannel.
+func WithImageVariant(variant string) Option {
+	return optionFunc(func(c *config) {
+		c.variant = variant
+	})
+}
+
+// WithRequireDocker makes Browser fail the test instead of skipping it when no
+// container provider is reachable. This is useful in CI, where a missing Docker
+// daemon is a setup error rather than a reason to skip.
+func WithRequireDocker() Option {
+	return optionFunc(func(c *config) {
+		c.requireDocker = true
+	})
+}
+
+// WithObserver registers an observer notified of what the session does, see
+// Observer. It can be given several times to register several observers,
+// notified in order.
+func WithObserver(observer Observer) Option {
+	return optionFunc(func(c *config) {
+		if observer != nil {
+			c.observers = append(c.observers, observer)
+		}
+	})
+}
+
+// defaultSignalTimeout bounds the teardown on a signal by default.
+const defaultSignalTimeout = 10 * time.Second
+
+// WithSignalHandler makes Install tear the default session down, like the
+// last Uninstall would, when the process receives SIGINT or SIGTERM, then
+// raise the signal again so the process still dies of it. This keeps Ctrl-C
+// during "go test" from leaving the container, the proxy and the Playwright
+// driver behind when no reaper runs.
+//
+// The teardown is given up after timeout, 10 seconds when it is 0. Calls to
+// Uninstall after the teardown are no-ops. Main sets the option, with the
+// default timeout unless given.
+func WithSignalHandler(timeout time.Duration) Option {
+	return optionFunc(func(c *config) {
+		if timeout <= 0 {
+			timeout = defaultSignalTimeout
+		}
+		c.signals = timeout
+	})
+}
+
+// WithOutput streams the output of the browser servers to w as they run, each
+// line prefixed with the name of the browser, such as "[chromium] ". The output
+// of each server is also kept, see BrowserOutput.
+func WithOutput(w io.Writer) Option {
+	return optionFunc(func(c *config) {
+		if w != nil {
+			c.output = &syncWriter{w: w}
+		}
+	})
+}
+
+// WithServerDebug sets the DEBUG environment variable of the browser servers
+// to namespaces, such as "pw:browser*", so that Playwright logs what it does in
+// their output, see WithOutput.
+func WithServerDebug(namespaces string) Option {
+	return optionFunc(func(c *config) {
+		c.serverDebug = namespaces
+	})
+}
+
+// WithHARRecording records the requests of the browsers going through the
+// proxy to HAR 1.2 files in dir: one per session, named after the process and
+// session, and one per value of the HARHeader request header, named after that
+// value, so that a browser context setting it is recorded in a file of its
+// own. Each request is written once its response completed, so that the files
+// survive a crash of the process. Bodies are recorded up to a limit, see
+// WithHARBodyLimit.
+//
+// HTTPS requests go through their tunnels unrecorded, see
+// WithHARRecordingHTTPS.
+func WithHARRecording(dir string) Option {
+	return optionFunc(func(c *config) {
+		c.har = dir
+	})
+}
+
+// WithHARRecordingHTTPS records the HTTPS requests too, see WithHARRecording:
+// the proxy looks into their tunnels with a certificate of its own, which
+// browser contexts must accept with their IgnoreHttpsErrors option, or their
+// HTTPS requests fail.
+func WithHARRecordingHTTPS() Option {
+	return optionFunc(func(c *config) {
+		c.harHTTPS = true
+	})
+}
+
+// WithHARBodyLimit sets how many bytes of each request and response body HAR
+// recordings keep. The default is 1 MiB.
+func WithHARBodyLimit(size int) Option {
+	return optionFunc(func(c *config) {
+		if size >= 0 {
+			c.harBodyLimit = size
+		}
+	})
+}
+
+// WithHARReplay makes the proxy answer the requests of the browsers from the
+// HAR file at path, such as one recorded with WithHARRecording, for tests that
+// do not depend on third-party APIs and CDNs. Requests match an entry on their
+// method and URL, and on their body with WithHARReplayBody; a request recorded
+// several times is answered with its responses in order, the last one being
+// repeated. policy tells what happens to the requests that match no entry,
+// which are reported when the session closes.
+//
+// The proxy looks into the HTTPS tunnels to the hosts of the HAR with a
+// certificate of its own, which browser contexts must accept with their
+// IgnoreHttpsErrors option. Unless policy is ReplayPassthrough, it refuses the
+// tunnels to other hosts, which match no entry.
+func WithHARReplay(path string, policy ReplayPolicy) Option {
+	return optionFunc(func(c *config) {
+		c.replay = path
+		c.replayPolicy = policy
+	})
+}
+
+// WithHARReplayBody makes the requests replayed with WithHARReplay also match
+// entries on their body.
+func WithHARReplayBody() Option {
+	return optionFunc(func(c *config) {
+		c.replayMatchBody = true
+	})
+}
+
+// WithProxyHandler answers the requests of the browsers matching all of
+// matchers, or all of them without matchers, with handler, as if it was their
+// server, to stub backends in Go. It can be given several times; see
+// Session.Proxy to register handlers while the session runs, and Proxy for
+// the HTTPS requests, which browser contexts must set IgnoreHttpsErrors for.
+func WithProxyHandler(handler http.Handler, matchers ...RequestMatcher) Option {
+	return optionFunc(func(c *config) {
+		c.proxy.OnRequest(matchers...).Handle(handler)
+	})
+}
+
+// WithHostMapping makes the proxy connect to target, an address such as
+// "127.0.0.1:8080", when the browsers reach host, so that apps depending on
+// their hostname, for their cookies or OAuth redirect URIs for instance, can be
+// visited as "http://app.test". host may be a wildcard such as "*.app.test",
+// matching its subdomains, to test multi-tenant apps. Requests keep the Host
+// header the browser sent. A target without port keeps the port of the
+// request. It can be given several times, the first mapping matching wins.
+func WithHostMapping(host, target string) Option {
+	return optionFunc(func(c *config) {
+		if host != "" && target != "" {
+			c.hosts = append(c.hosts, hostMapping{pattern: strings.ToLower(host), target: target})
+		}
+	})
+}
+
+// WithLogger sets the logger the library writes to, with attributes such as
+// browser, container_id, tag_source and attempt. Details of what it does are
+// logged at the debug level, problems it recovers from at the warn level.
+// The default is slog.Default(); see TestLogger to log to a test.
+func WithLogger(logger *slog.Logger) Option {
+	return optionFunc(func(c *config) {
+		if logger != nil {
+			c.logger = logger
+		}
+	})
+}
+
+// WithVerbose logs debug records to stderr, along with the output of the
+// Playwright driver and the proxy. It has no effect with WithLogger, whose
+// logger decides which levels to log.
 func WithVerbose() Option {
 	return optionFunc(func(c *config) {
-		c.verbose = true
+		if c.logger == nil {
+			c.logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		}
 	})
 }
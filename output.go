@@ -0,0 +1,117 @@
+package playwrightcigo
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+)
+
+// maxCapture bounds the output kept for each run of a browser server: only
+// its end is kept beyond that.
+const maxCapture = 1 << 20
+
+// capture keeps the output of a run of a browser server, see BrowserOutput.
+// Once maxCapture bytes are kept, buf is a ring whose oldest byte is at start.
+type capture struct {
+	mutex   sync.Mutex
+	buf     []byte
+	start   int
+	dropped int
+}
+
+func (c *capture) Write(p []byte) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	n := len(p)
+	if room := maxCapture - len(c.buf); room > 0 {
+		k := min(room, len(p))
+		c.buf = append(c.buf, p[:k]...)
+		p = p[k:]
+	}
+	// The buffer is full: overwrite its oldest bytes.
+	for len(p) > 0 {
+		k := copy(c.buf[c.start:], p)
+		c.dropped += k
+		c.start = (c.start + k) % maxCapture
+		p = p[k:]
+	}
+	return n, nil
+}
+
+// String returns the output kept, noting how much of its beginning was dropped.
+func (c *capture) String() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.dropped > 0 {
+		return fmt.Sprintf("[%d bytes dropped]\n%s%s", c.dropped, c.buf[c.start:], c.buf[:c.start])
+	}
+	return string(c.buf)
+}
+
+// syncWriter serializes the writes to the writer given to WithOutput, which
+// the servers of a session share.
+type syncWriter struct {
+	mutex sync.Mutex
+	w     io.Writer
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.w.Write(p)
+}
+
+// lenientWriter writes to the writer given to WithOutput, logging its failures
+// instead of returning them: the output of a healthy server is still read, and
+// the server is not taken for dead, when that writer fails. Only the first
+// failure is logged.
+type lenientWriter struct {
+	w       io.Writer
+	logger  *slog.Logger
+	browser string
+	failed  bool
+}
+
+func (l *lenientWriter) Write(p []byte) (int, error) {
+	if _, err := l.w.Write(p); err != nil && !l.failed {
+		l.failed = true
+		l.logger.Warn("could not write browser server output", "browser", l.browser, "error", err)
+	}
+	return len(p), nil
+}
+
+// prefixWriter writes whole lines to w, each one prefixed. The last line is
+// only written once complete, or on Flush.
+type prefixWriter struct {
+	w       io.Writer
+	prefix  string
+	partial []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.partial = append(p.partial, b...)
+	for {
+		i := bytes.IndexByte(p.partial, '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+		if _, err := p.w.Write(append([]byte(p.prefix), p.partial[:i+1]...)); err != nil {
+			return len(b), err
+		}
+		p.partial = p.partial[i+1:]
+	}
+}
+
+// Flush writes the last line if it is not complete.
+func (p *prefixWriter) Flush() error {
+	if len(p.partial) == 0 {
+		return nil
+	}
+	_, err := p.w.Write(append([]byte(p.prefix), append(p.partial, '\n')...))
+	p.partial = nil
+	return err
+}
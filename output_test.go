@@ -0,0 +1,78 @@
+package playwrightcigo
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Capture(t *testing.T) {
+	t.Parallel()
+
+	c := &capture{}
+	_, err := c.Write([]byte("ready endpoint: ws://"))
+	require.NoError(t, err)
+	assert.Equal(t, "ready endpoint: ws://", c.String())
+
+	// Only the end of a long output is kept.
+	_, err = c.Write([]byte(strings.Repeat("x", maxCapture)))
+	require.NoError(t, err)
+	output := c.String()
+	assert.True(t, strings.HasPrefix(output, "[21 bytes dropped]\n"))
+	assert.Len(t, output, len("[21 bytes dropped]\n")+maxCapture)
+
+	// Later writes overwrite the oldest bytes, in order.
+	_, err = c.Write([]byte("pw:browser closed\n"))
+	require.NoError(t, err)
+	output = c.String()
+	assert.True(t, strings.HasPrefix(output, "[39 bytes dropped]\n"))
+	assert.True(t, strings.HasSuffix(output, "xpw:browser closed\n"))
+	assert.Len(t, output, len("[39 bytes dropped]\n")+maxCapture)
+}
+
+func Test_PrefixWriter(t *testing.T) {
+	t.Parallel()
+
+	var b bytes.Buffer
+	w := &prefixWriter{w: &b, prefix: "[chromium] "}
+
+	_, err := w.Write([]byte("ready endpoint: ws://"))
+	require.NoError(t, err)
+	assert.Empty(t, b.String())
+
+	_, err = w.Write([]byte("0.0.0.0:1025/chromium\npw:browser launching\npartial"))
+	require.NoError(t, err)
+	assert.Equal(t, "[chromium] ready endpoint: ws://0.0.0.0:1025/chromium\n[chromium] pw:browser launching\n", b.String())
+
+	require.NoError(t, w.Flush())
+	assert.Equal(t, "[chromium] ready endpoint: ws://0.0.0.0:1025/chromium\n[chromium] pw:browser launching\n[chromium] partial\n", b.String())
+}
+
+// failingWriter fails every write.
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func Test_LenientWriter(t *testing.T) {
+	t.Parallel()
+
+	var logs bytes.Buffer
+	w := &lenientWriter{w: failingWriter{}, logger: slog.New(slog.NewTextHandler(&logs, nil)), browser: "chromium"}
+
+	// The failures are not returned, and only logged once.
+	for range 2 {
+		n, err := w.Write([]byte("pw:browser launching\n"))
+		require.NoError(t, err)
+		assert.Equal(t, len("pw:browser launching\n"), n)
+	}
+	assert.Equal(t, 1, strings.Count(logs.String(), "could not write browser server output"))
+	assert.Contains(t, logs.String(), "browser=chromium")
+	assert.Contains(t, logs.String(), "broken pipe")
+}
@@ -1,6 +1,8 @@
 package playwrightcigo
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"image"
@@ -9,6 +11,8 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -240,6 +244,447 @@ func Test_OverlapLifecycle(t *testing.T) {
 	}
 }
 
+func Test_Sessions(t *testing.T) {
+	t.Parallel()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	base := "http://" + l.Addr().String()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("Hello World!"))
+	})
+	srv := &http.Server{
+		Handler: mux,
+	}
+
+	go func() {
+		err := srv.Serve(l)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Could not serve: %v", err)
+		}
+	}()
+
+	err = Wait4Port(base)
+	require.NoError(t, err)
+
+	// Two sessions never share a container, so each one has its own servers.
+	session1, err := New(WithRepository(os.Getenv("PLAYWRIGHTCI_REPOSITORY"), os.Getenv("PLAYWRIGHTCI_TAG")), WithTimeout(time.Minute))
+	require.NoError(t, err)
+
+	session2, err := New(WithRepository(os.Getenv("PLAYWRIGHTCI_REPOSITORY"), os.Getenv("PLAYWRIGHTCI_TAG")), WithTimeout(time.Minute))
+	require.NoError(t, err)
+
+	for _, s := range []*Session{session1, session2} {
+		browser, err := s.Chromium()
+		require.NoError(t, err)
+
+		page, err := browser.NewPage()
+		require.NoError(t, err)
+
+		_, err = page.Goto(base)
+		require.NoError(t, err)
+
+		content, err := page.Content()
+		require.NoError(t, err)
+		require.Contains(t, content, "Hello World!")
+
+		err = browser.Close()
+		require.NoError(t, err)
+	}
+
+	err = session1.Close()
+	require.NoError(t, err)
+
+	// Closing one session leaves the other untouched.
+	browser, err := session2.Chromium()
+	require.NoError(t, err)
+	err = browser.Close()
+	require.NoError(t, err)
+
+	_, err = session1.Chromium()
+	require.Error(t, err)
+
+	err = session2.Close()
+	require.NoError(t, err)
+}
+
+func Test_Browser(t *testing.T) {
+	t.Parallel()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	base := "http://" + l.Addr().String()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("Hello World!"))
+	})
+	srv := &http.Server{
+		Handler: mux,
+	}
+
+	go func() {
+		err := srv.Serve(l)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Could not serve: %v", err)
+		}
+	}()
+
+	err = Wait4Port(base)
+	require.NoError(t, err)
+
+	opts := []Option{WithRepository(os.Getenv("PLAYWRIGHTCI_REPOSITORY"), os.Getenv("PLAYWRIGHTCI_TAG")), WithTimeout(time.Minute)}
+	if os.Getenv("CI") != "" {
+		opts = append(opts, WithRequireDocker())
+	}
+
+	// No Uninstall nor Close here: Browser registers both as cleanups.
+	browser := Browser(t, "chromium", opts...)
+
+	page, err := browser.NewPage()
+	require.NoError(t, err)
+
+	_, err = page.Goto(base)
+	require.NoError(t, err)
+
+	content, err := page.Content()
+	require.NoError(t, err)
+	require.Contains(t, content, "Hello World!")
+}
+
+func Test_Launch(t *testing.T) {
+	t.Parallel()
+
+	session, err := New(WithRepository(os.Getenv("PLAYWRIGHTCI_REPOSITORY"), os.Getenv("PLAYWRIGHTCI_TAG")), WithTimeout(time.Minute))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, session.Close()) }()
+
+	english, err := session.Launch("chromium", LaunchOptions{Args: []string{"--lang=en-US"}})
+	require.NoError(t, err)
+
+	french, err := session.Launch("chromium", LaunchOptions{Args: []string{"--lang=fr-FR"}})
+	require.NoError(t, err)
+
+	status, err := session.Status()
+	require.NoError(t, err)
+	assert.NotEmpty(t, status.ContainerID)
+	assert.NotEmpty(t, status.ImageDigest)
+	assert.NotEmpty(t, status.Tag)
+	assert.NotEmpty(t, status.TagSource)
+	require.Len(t, status.Browsers, 2)
+	for _, browser := range status.Browsers {
+		assert.Equal(t, "chromium", browser.Name)
+		assert.Equal(t, 1, browser.Connections)
+		assert.NotZero(t, status.Ports[browser.Port])
+	}
+
+	for browser, want := range map[playwright.Browser]string{english: "en-US", french: "fr-FR"} {
+		page, err := browser.NewPage()
+		require.NoError(t, err)
+
+		language, err := page.Evaluate("navigator.language")
+		require.NoError(t, err)
+		assert.Equal(t, want, language)
+
+		err = browser.Close()
+		require.NoError(t, err)
+	}
+
+	// The plain image has no branded channels.
+	_, err = session.Launch("chromium", WithChannel("msedge"))
+	assert.ErrorIs(t, err, ErrChannelUnavailable)
+}
+
+func Test_Observer(t *testing.T) {
+	t.Parallel()
+
+	observer := &recorder{}
+	session, err := New(WithRepository(os.Getenv("PLAYWRIGHTCI_REPOSITORY"), os.Getenv("PLAYWRIGHTCI_TAG")), WithTimeout(time.Minute), WithObserver(observer))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"container started <nil>"}, observer.recorded())
+
+	browser, err := session.Chromium()
+	require.NoError(t, err)
+	assert.Contains(t, observer.recorded(), "chromium launched <nil>")
+	require.NoError(t, browser.Close())
+
+	require.NoError(t, session.Close())
+	assert.Contains(t, observer.recorded(), "container stopped <nil>")
+}
+
+func Test_DedicatedServers(t *testing.T) {
+	t.Parallel()
+
+	session, err := New(WithRepository(os.Getenv("PLAYWRIGHTCI_REPOSITORY"), os.Getenv("PLAYWRIGHTCI_TAG")), WithTimeout(time.Minute))
+	require.NoError(t, err)
+	// The parallel subtests only run once this function returned.
+	t.Cleanup(func() { require.NoError(t, session.Close()) })
+
+	// Each test gets a Firefox server of its own, so they do not contend.
+	for i := range 2 {
+		t.Run(fmt.Sprintf("firefox-%d", i), func(t *testing.T) {
+			t.Parallel()
+
+			browser, err := session.Launch("firefox", WithDedicatedServer())
+			require.NoError(t, err)
+			defer func() { require.NoError(t, browser.Close()) }()
+
+			page, err := browser.NewPage()
+			require.NoError(t, err)
+
+			err = page.SetContent("<p>Hello World!</p>")
+			require.NoError(t, err)
+
+			content, err := page.Content()
+			require.NoError(t, err)
+			require.Contains(t, content, "Hello World!")
+		})
+	}
+}
+
+func Test_CloseThroughPage(t *testing.T) {
+	t.Parallel()
+
+	session, err := New(WithRepository(os.Getenv("PLAYWRIGHTCI_REPOSITORY"), os.Getenv("PLAYWRIGHTCI_TAG")), WithTimeout(time.Minute), WithIdleTimeout(0))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, session.Close()) }()
+
+	browser, err := session.Chromium()
+	require.NoError(t, err)
+	page, err := browser.NewPage()
+	require.NoError(t, err)
+
+	// The browser of the page is not the one the launch returned, closing it
+	// releases the server all the same.
+	require.NoError(t, page.Context().Browser().Close())
+	require.Eventually(t, func() bool {
+		status, err := session.Status()
+		return err == nil && len(status.Browsers) == 0
+	}, 10*time.Second, 100*time.Millisecond)
+
+	session.mutexBrowser.Lock()
+	assert.Empty(t, session.leaks())
+	session.mutexBrowser.Unlock()
+}
+
+func Test_Pool(t *testing.T) {
+	t.Parallel()
+
+	session, err := New(WithRepository(os.Getenv("PLAYWRIGHTCI_REPOSITORY"), os.Getenv("PLAYWRIGHTCI_TAG")), WithTimeout(time.Minute))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, session.Close()) }()
+
+	pool := session.NewPool(WithPoolSize(2), WithPoolMaxConnections(1), WithPoolFailFast())
+	defer func() { require.NoError(t, pool.Close()) }()
+
+	ctx := context.Background()
+	first, err := pool.Acquire(ctx, "chromium")
+	require.NoError(t, err)
+	second, err := pool.Acquire(ctx, "chromium")
+	require.NoError(t, err)
+
+	// Each server of the pool has its one connection.
+	_, err = pool.Acquire(ctx, "chromium")
+	assert.ErrorIs(t, err, ErrPoolExhausted)
+
+	status, err := session.Status()
+	require.NoError(t, err)
+	require.Len(t, status.Browsers, 2)
+	for _, browser := range status.Browsers {
+		assert.Equal(t, 1, browser.Connections)
+	}
+
+	for _, browser := range []playwright.Browser{first, second} {
+		page, err := browser.NewPage()
+		require.NoError(t, err)
+
+		err = page.SetContent("<p>Hello World!</p>")
+		require.NoError(t, err)
+
+		content, err := page.Content()
+		require.NoError(t, err)
+		assert.Contains(t, content, "Hello World!")
+	}
+
+	// A release makes room for the next acquisition, on the running server.
+	require.NoError(t, pool.Release(first))
+	third, err := pool.Acquire(ctx, "chromium")
+	require.NoError(t, err)
+	require.NoError(t, pool.Release(third))
+	require.NoError(t, pool.Release(second))
+
+	status, err = session.Status()
+	require.NoError(t, err)
+	assert.Len(t, status.Browsers, 2)
+}
+
+func Test_ServeChromium(t *testing.T) {
+	t.Parallel()
+
+	opts := []Option{WithRepository(os.Getenv("PLAYWRIGHTCI_REPOSITORY"), os.Getenv("PLAYWRIGHTCI_TAG")), WithTimeout(time.Minute)}
+	if os.Getenv("CI") != "" {
+		opts = append(opts, WithRequireDocker())
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("<p>Hello " + r.Host + "</p>"))
+	})
+	mux.HandleFunc("/api/user", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"user":"alice"}`))
+	})
+	base := Serve(t, mux, opts...)
+	browser := Browser(t, "chromium", opts...)
+
+	page, err := browser.NewPage()
+	require.NoError(t, err)
+	defer func() { require.NoError(t, page.Close()) }()
+
+	resp, err := page.Goto(base)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.Status())
+	content, err := page.Content()
+	require.NoError(t, err)
+	assert.Contains(t, content, "Hello "+strings.TrimPrefix(base, "http://"))
+
+	// The page reaches the other routes of the handler too.
+	user, err := page.Evaluate(`async () => (await fetch("/api/user")).json()`)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"user": "alice"}, user)
+}
+
+func Test_Restart(t *testing.T) {
+	t.Parallel()
+
+	session, err := New(WithRepository(os.Getenv("PLAYWRIGHTCI_REPOSITORY"), os.Getenv("PLAYWRIGHTCI_TAG")), WithTimeout(time.Minute))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, session.Close()) }()
+
+	lost, err := session.Webkit()
+	require.NoError(t, err)
+
+	// Kill the server as the OOM killer would.
+	code, _, err := session.running().browsers.Exec(t.Context(), []string{"sh", "-c", `kill -9 "$(cat "$0")"`, pidFile(session.specs["webkit"].Port)})
+	require.NoError(t, err)
+	require.Equal(t, 0, code)
+
+	require.Eventually(t, func() bool {
+		return session.BrowserErr(lost) != nil
+	}, 10*time.Second, 100*time.Millisecond)
+	var serverErr *BrowserServerError
+	require.ErrorAs(t, session.BrowserErr(lost), &serverErr)
+	assert.Equal(t, "webkit", serverErr.Browser)
+
+	// The next launch relaunches the server.
+	browser, err := session.Webkit()
+	require.NoError(t, err)
+	defer func() { require.NoError(t, browser.Close()) }()
+
+	status, err := session.Status()
+	require.NoError(t, err)
+	require.Len(t, status.Browsers, 1)
+	assert.Equal(t, 1, status.Browsers[0].Restarts)
+
+	page, err := browser.NewPage()
+	require.NoError(t, err)
+	require.NoError(t, page.SetContent("<p>Hello again!</p>"))
+	assert.NoError(t, session.BrowserErr(browser))
+
+	// A dedicated server that died is not relaunched, the next launch
+	// starts another one.
+	lost, err = session.Launch("webkit", WithDedicatedServer())
+	require.NoError(t, err)
+	code, _, err = session.running().browsers.Exec(t.Context(), []string{"sh", "-c", `kill -9 "$(cat "$0")"`, pidFile(portPoolBase)})
+	require.NoError(t, err)
+	require.Equal(t, 0, code)
+	require.Eventually(t, func() bool {
+		return session.BrowserErr(lost) != nil
+	}, 10*time.Second, 100*time.Millisecond)
+
+	dedicated, err := session.Launch("webkit", WithDedicatedServer())
+	require.NoError(t, err)
+	defer func() { require.NoError(t, dedicated.Close()) }()
+	page, err = dedicated.NewPage()
+	require.NoError(t, err)
+	require.NoError(t, page.SetContent("<p>Hello again!</p>"))
+	assert.NoError(t, session.BrowserErr(dedicated))
+}
+
+func Test_Output(t *testing.T) {
+	t.Parallel()
+
+	var live bytes.Buffer
+	var mutex sync.Mutex
+	session, err := New(WithRepository(os.Getenv("PLAYWRIGHTCI_REPOSITORY"), os.Getenv("PLAYWRIGHTCI_TAG")), WithTimeout(time.Minute), WithServerDebug("pw:browser*"), WithOutput(writerFunc(func(p []byte) (int, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return live.Write(p)
+	})))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, session.Close()) }()
+
+	browser, err := session.Chromium()
+	require.NoError(t, err)
+	defer func() { require.NoError(t, browser.Close()) }()
+
+	assert.Contains(t, session.BrowserOutput(browser), "ready endpoint:")
+	assert.Contains(t, session.BrowserOutput(browser), "pw:browser")
+	assert.Eventually(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return strings.Contains(live.String(), "[chromium] ready endpoint:")
+	}, 5*time.Second, 100*time.Millisecond)
+}
+
+// writerFunc adapts a function to io.Writer.
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+func Test_Reuse(t *testing.T) {
+	t.Parallel()
+
+	// Two sessions stand for two test binaries sharing the container.
+	opts := []Option{WithRepository(os.Getenv("PLAYWRIGHTCI_REPOSITORY"), os.Getenv("PLAYWRIGHTCI_TAG")), WithTimeout(time.Minute), WithReuse(t.Name())}
+	first, err := New(opts...)
+	require.NoError(t, err)
+	second, err := New(opts...)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, second.Close()) }()
+
+	require.True(t, first.shared)
+	require.True(t, second.shared)
+	assert.Equal(t, first.running().browsers.GetContainerID(), second.running().browsers.GetContainerID())
+	assert.NotEqual(t, first.slot, second.slot)
+
+	hello := func(session *Session) {
+		browser, err := session.Firefox()
+		require.NoError(t, err)
+		defer func() { require.NoError(t, browser.Close()) }()
+
+		page, err := browser.NewPage()
+		require.NoError(t, err)
+		require.NoError(t, page.SetContent("<p>Hello World!</p>"))
+	}
+	hello(first)
+	hello(second)
+
+	// The container outlives the first session.
+	require.NoError(t, first.Close())
+	hello(second)
+}
+
 func TestMain(m *testing.M) {
 	if err := os.MkdirAll("testdata/failed", 0755); err != nil {
 		log.Fatalf("could not create directory: %v", err)
@@ -0,0 +1,314 @@
+package playwrightcigo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/mxschmitt/playwright-go"
+)
+
+// ErrPoolExhausted is returned by Pool.Acquire, when the pool fails fast,
+// if every server of the browser already has its maximum of connections.
+var ErrPoolExhausted = errors.New("all browser servers of the pool are busy")
+
+// Pool hands out browser connections spread over several dedicated servers
+// per browser, so that suites running many tests in parallel are not all
+// funneled into a single browser server.
+//
+// Servers are started on first use and kept running until Close, unless
+// connecting to one fails: the next Acquire starts another in its place. Each
+// Acquire picks the server with the fewest connections, and the browser it
+// returns goes back to the pool with Release.
+type Pool struct {
+	session *Session
+
+	sizes          map[string]int
+	size           int
+	maxConnections int
+	failFast       bool
+	launch         LaunchOptions
+
+	mutex   sync.Mutex
+	changed chan struct{}
+	closed  bool
+	servers map[string][]*poolServer
+	leased  map[playwright.Browser]*poolServer
+}
+
+// poolServer is one of the servers of a pool. server and held are only
+// accessed with the session's mutexBrowser held, active with the pool's mutex
+// held. held tells whether the pool holds its reference on server.
+type poolServer struct {
+	server *browser
+	held   bool
+	active int
+}
+
+// PoolOption configures a Pool.
+type PoolOption interface {
+	applyPool(*Pool)
+}
+
+var _ PoolOption = (*poolOptionFunc)(nil)
+
+type poolOptionFunc func(*Pool)
+
+func (f poolOptionFunc) applyPool(p *Pool) {
+	f(p)
+}
+
+// WithPoolSize sets how many servers the pool runs for the named browsers,
+// or for every browser when no name is given. The default is 2.
+func WithPoolSize(size int, names ...string) PoolOption {
+	return poolOptionFunc(func(p *Pool) {
+		if size <= 0 {
+			return
+		}
+		if len(names) == 0 {
+			p.size = size
+		}
+		for _, name := range names {
+			p.sizes[name] = size
+		}
+	})
+}
+
+// WithPoolMaxConnections limits how many browsers acquired from the pool may
+// be connected to the same server. Once every server of a browser is at the
+// limit, Acquire waits for a Release, or fails with WithPoolFailFast.
+// The default is no limit.
+func WithPoolMaxConnections(count int) PoolOption {
+	return poolOptionFunc(func(p *Pool) {
+		if count > 0 {
+			p.maxConnections = count
+		}
+	})
+}
+
+// WithPoolFailFast makes Acquire return ErrPoolExhausted instead of waiting
+// when every server of the browser is at its maximum of connections.
+func WithPoolFailFast() PoolOption {
+	return poolOptionFunc(func(p *Pool) {
+		p.failFast = true
+	})
+}
+
+// WithPoolLaunchOptions sets the launch options of the pool's servers.
+func WithPoolLaunchOptions(opts ...LaunchOption) PoolOption {
+	return poolOptionFunc(func(p *Pool) {
+		for _, opt := range opts {
+			opt.applyLaunch(&p.launch)
+		}
+	})
+}
+
+// NewPool creates a Pool of servers in the container of the default session.
+func NewPool(opts ...PoolOption) (*Pool, error) {
+	s, err := defaultSession()
+	if err != nil {
+		return nil, err
+	}
+	return s.NewPool(opts...), nil
+}
+
+// NewPool creates a Pool of servers in the session's container.
+// Servers take their ports from the session's pool, see WithPortPool.
+func (s *Session) NewPool(opts ...PoolOption) *Pool {
+	p := &Pool{
+		session: s,
+		sizes:   map[string]int{},
+		size:    2,
+		changed: make(chan struct{}),
+		servers: map[string][]*poolServer{},
+		leased:  map[playwright.Browser]*poolServer{},
+	}
+	for _, opt := range opts {
+		opt.applyPool(p)
+	}
+	p.launch.Dedicated = true
+	return p
+}
+
+// Acquire returns a browser of the given name connected to the least loaded
+// of the pool's servers for it, starting that server if needed.
+// Give the browser back with Release rather than closing it.
+func (p *Pool) Acquire(ctx context.Context, name string) (playwright.Browser, error) {
+	ps, err := p.reserve(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	pb, server, err := p.connect(ctx, name, ps)
+	if err != nil {
+		p.unreserve(ps)
+		return nil, err
+	}
+
+	p.mutex.Lock()
+	if p.closed {
+		// Close did not see the browser, nor maybe the server it started.
+		p.mutex.Unlock()
+		_ = pb.Close()
+		p.retire(ps, server)
+		p.unreserve(ps)
+		return nil, fmt.Errorf("could not acquire %s: pool is closed", name)
+	}
+	defer p.mutex.Unlock()
+	p.leased[pb] = ps
+	return pb, nil
+}
+
+// Release closes a browser returned by Acquire, making room on its server.
+func (p *Pool) Release(pb playwright.Browser) error {
+	p.mutex.Lock()
+	ps, ok := p.leased[pb]
+	delete(p.leased, pb)
+	p.mutex.Unlock()
+
+	if !ok {
+		return fmt.Errorf("browser was not acquired from this pool")
+	}
+
+	err := pb.Close()
+	p.unreserve(ps)
+	return err
+}
+
+// Close releases the browsers still acquired and stops the pool's servers.
+func (p *Pool) Close() error {
+	p.mutex.Lock()
+	p.closed = true
+	leased := p.leased
+	p.leased = map[playwright.Browser]*poolServer{}
+	servers := p.servers
+	p.servers = map[string][]*poolServer{}
+	close(p.changed)
+	p.mutex.Unlock()
+
+	var errs []error
+	for pb := range leased {
+		if err := pb.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// Give up the reference the pool holds on each server.
+	for _, list := range servers {
+		for _, ps := range list {
+			p.retire(ps, nil)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// reserve picks the least loaded server for name and counts a connection on
+// it, waiting for room if the pool is saturated.
+func (p *Pool) reserve(ctx context.Context, name string) (*poolServer, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for {
+		if p.closed {
+			return nil, fmt.Errorf("pool is closed")
+		}
+
+		list, ok := p.servers[name]
+		if !ok {
+			size, ok := p.sizes[name]
+			if !ok {
+				size = p.size
+			}
+			list = make([]*poolServer, size)
+			for i := range list {
+				list[i] = &poolServer{}
+			}
+			p.servers[name] = list
+		}
+
+		var least *poolServer
+		for _, ps := range list {
+			if least == nil || ps.active < least.active {
+				least = ps
+			}
+		}
+		if p.maxConnections == 0 || least.active < p.maxConnections {
+			least.active++
+			return least, nil
+		}
+
+		if p.failFast {
+			return nil, fmt.Errorf("could not acquire %s: %w", name, ErrPoolExhausted)
+		}
+
+		changed := p.changed
+		p.mutex.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			p.mutex.Lock()
+			return nil, fmt.Errorf("could not acquire %s: %w", name, ctx.Err())
+		}
+		p.mutex.Lock()
+	}
+}
+
+// unreserve gives back a connection counted by reserve and wakes up waiters.
+func (p *Pool) unreserve(ps *poolServer) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	ps.active--
+	if !p.closed {
+		close(p.changed)
+		p.changed = make(chan struct{})
+	}
+}
+
+// retire gives up the reference the pool holds on server, if ps still holds
+// it, or on whatever server ps holds when server is nil.
+func (p *Pool) retire(ps *poolServer, server *browser) {
+	s := p.session
+	s.mutexBrowser.Lock()
+	stop := func() {}
+	if ps.held && (server == nil || ps.server == server) {
+		ps.held = false
+		stop = ps.server.unref()
+	}
+	s.mutexBrowser.Unlock()
+	stop()
+}
+
+// connect connects to the pool server ps, starting it if needed. It returns
+// the browser and the server it is connected to.
+func (p *Pool) connect(ctx context.Context, name string, ps *poolServer) (playwright.Browser, *browser, error) {
+	s := p.session
+
+	// The lock is only held to pick the server, see Session.LaunchContext.
+	s.mutexBrowser.Lock()
+	if !ps.held || ps.server.count == 0 {
+		b, err := s.server(name, p.launch)
+		if err != nil {
+			s.mutexBrowser.Unlock()
+			return nil, nil, err
+		}
+		// The pool keeps its own reference so that the server keeps
+		// running between acquisitions.
+		b.count++
+		ps.server, ps.held = b, true
+	}
+	b := ps.server
+	b.reserve()
+	s.mutexBrowser.Unlock()
+
+	pb, err := b.connect(ctx)
+	if err != nil {
+		// The server is not tried again: the next acquisition starts a new
+		// one in its place.
+		p.retire(ps, b)
+		return nil, nil, err
+	}
+	return pb, b, nil
+}
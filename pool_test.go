@@ -0,0 +1,127 @@
+package playwrightcigo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_PoolReserveLeastLoaded(t *testing.T) {
+	t.Parallel()
+
+	p := (&Session{}).NewPool(WithPoolSize(3), WithPoolSize(1, "webkit"))
+
+	first, err := p.reserve(context.Background(), "chromium")
+	require.NoError(t, err)
+	second, err := p.reserve(context.Background(), "chromium")
+	require.NoError(t, err)
+	third, err := p.reserve(context.Background(), "chromium")
+	require.NoError(t, err)
+	assert.NotSame(t, first, second)
+	assert.NotSame(t, second, third)
+	assert.NotSame(t, first, third)
+	assert.Len(t, p.servers["chromium"], 3)
+
+	// Once all are busy, the least loaded is the one released first.
+	p.unreserve(second)
+	again, err := p.reserve(context.Background(), "chromium")
+	require.NoError(t, err)
+	assert.Same(t, second, again)
+
+	_, err = p.reserve(context.Background(), "webkit")
+	require.NoError(t, err)
+	assert.Len(t, p.servers["webkit"], 1)
+}
+
+func Test_PoolReserveFailFast(t *testing.T) {
+	t.Parallel()
+
+	p := (&Session{}).NewPool(WithPoolSize(1), WithPoolMaxConnections(1), WithPoolFailFast())
+
+	ps, err := p.reserve(context.Background(), "firefox")
+	require.NoError(t, err)
+
+	_, err = p.reserve(context.Background(), "firefox")
+	assert.ErrorIs(t, err, ErrPoolExhausted)
+
+	p.unreserve(ps)
+	_, err = p.reserve(context.Background(), "firefox")
+	assert.NoError(t, err)
+}
+
+func Test_PoolReserveWaits(t *testing.T) {
+	t.Parallel()
+
+	p := (&Session{}).NewPool(WithPoolSize(1), WithPoolMaxConnections(1))
+
+	ps, err := p.reserve(context.Background(), "firefox")
+	require.NoError(t, err)
+
+	// Saturated: waiting gives up with the context...
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = p.reserve(ctx, "firefox")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// ...or succeeds once a connection is released.
+	reserved := make(chan *poolServer)
+	go func() {
+		ps, err := p.reserve(context.Background(), "firefox")
+		assert.NoError(t, err)
+		reserved <- ps
+	}()
+
+	p.unreserve(ps)
+	assert.Same(t, ps, <-reserved)
+
+	require.NoError(t, p.Close())
+	_, err = p.reserve(context.Background(), "firefox")
+	assert.ErrorContains(t, err, "pool is closed")
+}
+
+func Test_PoolRetire(t *testing.T) {
+	t.Parallel()
+
+	s := &Session{specs: registered()}
+	p := s.NewPool(WithPoolSize(1))
+	ps, err := p.reserve(context.Background(), "firefox")
+	require.NoError(t, err)
+
+	// A server held by the pool and connected to a browser.
+	s.mutexBrowser.Lock()
+	failed, err := s.server("firefox", p.launch)
+	require.NoError(t, err)
+	failed.count = 2
+	ps.server, ps.held = failed, true
+	s.mutexBrowser.Unlock()
+
+	// The pool gives up its reference once, whoever asks...
+	p.retire(ps, failed)
+	p.retire(ps, failed)
+	p.retire(ps, nil)
+	s.mutexBrowser.Lock()
+	assert.Equal(t, 1, failed.count)
+	assert.False(t, ps.held)
+
+	// ...and not the one on the server that replaced it.
+	replacement, err := s.server("firefox", p.launch)
+	require.NoError(t, err)
+	replacement.count = 1
+	ps.server, ps.held = replacement, true
+	s.mutexBrowser.Unlock()
+
+	p.retire(ps, failed)
+	s.mutexBrowser.Lock()
+	assert.Equal(t, 1, replacement.count)
+	assert.True(t, ps.held)
+	s.mutexBrowser.Unlock()
+
+	require.NoError(t, p.Close())
+	s.mutexBrowser.Lock()
+	defer s.mutexBrowser.Unlock()
+	assert.Equal(t, 0, replacement.count)
+	assert.False(t, ps.held)
+}
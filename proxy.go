@@ -4,25 +4,73 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
+	"net/netip"
+	"slices"
 	"strconv"
 	"time"
 
 	"github.com/elazarl/goproxy"
-	"github.com/testcontainers/testcontainers-go"
 )
 
-func transparentProxy(retry int, sleeping time.Duration, verbose bool) (string, int, func()) {
+// transparentProxy starts the HTTP proxy the browsers in the container use to
+// reach the host, listening on the listen address. It returns the proxy
+// address as seen from the container, where the host is known as host, its
+// port and a function to stop it, which returns the requests that did not
+// match the HAR replayed, see WithHARReplay. A failure while serving is sent
+// to errs. When allowed is given, the proxy refuses the connections from
+// other addresses than those and the listen address itself, so that it is not
+// open to everything that reaches the listen address.
+func transparentProxy(listen, host string, c *config, errs chan<- error, allowed ...netip.Addr) (string, int, func() error, error) {
 	// Listen for incoming connections
-	l, err := net.Listen("tcp", "127.0.0.1:0")
+	l, err := net.Listen("tcp", net.JoinHostPort(listen, "0"))
 	if err != nil {
-		log.Fatal("Error listening:", err)
+		return "", 0, nil, fmt.Errorf("could not listen: %w", err)
+	}
+	if len(allowed) > 0 {
+		if self, err := netip.ParseAddr(listen); err == nil {
+			allowed = append(allowed, self)
+		}
+		l = &allowListener{Listener: l, allowed: allowed, logger: c.logger}
 	}
 
 	proxy := goproxy.NewProxyHttpServer()
-	proxy.Verbose = verbose
+	proxy.Verbose = c.debug()
+	proxy.Logger = slog.NewLogLogger(c.logger.Handler(), slog.LevelDebug)
+	if len(c.hosts) > 0 {
+		mapHosts(proxy, c.hosts, c)
+	}
+	var har *harRecorder
+	if c.har != "" {
+		har = newHARRecorder(c.har, c.harBodyLimit)
+		har.record(proxy)
+	}
+	if len(c.observers) > 0 {
+		observe(proxy, c.observers)
+	}
+	if c.proxy != nil {
+		c.proxy.intercept(proxy)
+	}
+	var replay *replayer
+	if c.replay != "" {
+		if replay, err = newReplayer(c.replay, c.replayPolicy, c.replayMatchBody); err != nil {
+			_ = l.Close()
+			return "", 0, nil, err
+		}
+		replay.replay(proxy)
+	}
+	tunnels := []string{}
+	if replay != nil {
+		tunnels = replay.tunnels()
+	}
+	mitm(proxy, func(connect *http.Request) bool {
+		return har != nil && c.harHTTPS || slices.Contains(tunnels, connect.URL.Host) || c.proxy != nil && c.proxy.tunnels(connect)
+	})
+	if replay != nil {
+		replay.refuse(proxy)
+	}
 
 	srv := &http.Server{
 		Handler:           proxy,
@@ -32,32 +80,95 @@ func transparentProxy(retry int, sleeping time.Duration, verbose bool) (string,
 	go func() {
 		err := srv.Serve(l)
 		if err != nil && !errors.Is(err, http.ErrServerClosed) {
-			log.Fatalf("Error serving proxy: %v", err)
+			report(c.logger, errs, fmt.Errorf("error serving proxy: %w", err))
 		}
 	}()
 
+	close := func() error {
+		_ = srv.Shutdown(context.Background())
+		_ = l.Close()
+		if har != nil {
+			if err := har.close(); err != nil {
+				c.logger.Warn("could not record HAR", "error", err)
+			}
+		}
+		if replay != nil {
+			return replay.report(c)
+		}
+		return nil
+	}
+
 	_, portStr, err := net.SplitHostPort(l.Addr().String())
 	if err != nil {
-		log.Fatalf("Failed to parse address %s: %v", l.Addr().String(), err)
+		_ = close()
+		return "", 0, nil, fmt.Errorf("failed to parse address %s: %w", l.Addr().String(), err)
 	}
 	port, err := strconv.ParseInt(portStr, 10, 64)
 	if err != nil {
-		log.Fatalf("Failed to parse port number from address %s: %v", l.Addr().String(), err)
+		_ = close()
+		return "", 0, nil, fmt.Errorf("failed to parse port number from address %s: %w", l.Addr().String(), err)
 	}
 	// Ensure the port number is within the valid range for a 16-bit unsigned integer
 	if port < 0 || port > 65535 {
-		log.Fatalf("Parsed port number %d is out of valid range (0-65535)", port)
+		_ = close()
+		return "", 0, nil, fmt.Errorf("parsed port number %d is out of valid range (0-65535)", port)
 	}
-	if err := Wait4Port("http://"+l.Addr().String(), WithRetry(retry), WithSleeping(sleeping)); err != nil {
-		log.Fatalf("Could not connect to proxy: %s", err)
+	if err := Wait4Port("http://"+l.Addr().String(), WithRetry(c.retry), WithSleeping(c.sleeping), WithObserver(c.observers), WithLogger(c.logger)); err != nil {
+		_ = close()
+		return "", 0, nil, fmt.Errorf("could not connect to proxy: %w", err)
 	}
 
-	return "http://" + testcontainers.HostInternal + ":" + portStr, int(port), func() {
-		_ = srv.Shutdown(context.Background())
-		_ = l.Close()
+	return "http://" + net.JoinHostPort(host, portStr), int(port), close, nil
+}
+
+// mitm makes proxy look into the HTTPS tunnels whose CONNECT request look
+// accepts, with a certificate of its own, so that the handlers recording,
+// stubbing or replaying requests see the requests going through them.
+// Browser contexts must accept that certificate with their
+// IgnoreHttpsErrors option.
+func mitm(proxy *goproxy.ProxyHttpServer, look func(connect *http.Request) bool) {
+	proxy.OnRequest().HandleConnectFunc(func(host string, ctx *goproxy.ProxyCtx) (*goproxy.ConnectAction, string) {
+		if look(ctx.Req) {
+			return goproxy.MitmConnect, host
+		}
+		return nil, host
+	})
+}
+
+// allowListener accepts the connections from the allowed addresses only.
+type allowListener struct {
+	net.Listener
+	allowed []netip.Addr
+	logger  *slog.Logger
+}
+
+func (l *allowListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		remote, err := netip.ParseAddrPort(conn.RemoteAddr().String())
+		if err == nil && slices.Contains(l.allowed, remote.Addr().Unmap()) {
+			return conn, nil
+		}
+		l.logger.Warn("refusing proxy connection", "remote", conn.RemoteAddr().String())
+		_ = conn.Close()
 	}
 }
 
+// observe notifies observer of the requests going through proxy.
+func observe(proxy *goproxy.ProxyHttpServer, observer Observer) {
+	proxy.OnRequest().DoFunc(func(req *http.Request, _ *goproxy.ProxyCtx) (*http.Request, *http.Response) {
+		observer.ProxyRequest(req)
+		return req, nil
+	})
+	proxy.OnResponse().DoFunc(func(resp *http.Response, ctx *goproxy.ProxyCtx) *http.Response {
+		observer.ProxyResponse(ctx.Req, resp, ctx.Error)
+		return resp
+	})
+}
+
 // Wait4Port checks if a network service is available at the given address.
 // It retries according to the provided options.
 // This is useful for ensuring that servers are ready before connecting to them.
@@ -66,15 +177,7 @@ func transparentProxy(retry int, sleeping time.Duration, verbose bool) (string,
 //   - addr: The URL to check (e.g. "http://localhost:8080")
 //   - opts: Configuration options for retries and timeout
 func Wait4Port(addr string, opts ...Option) error {
-	c := &config{
-		sleeping: 200 * time.Millisecond,
-		retry:    15,
-		verbose:  false,
-		ctx:      context.Background(),
-	}
-	for _, opt := range opts {
-		opt.apply(c)
-	}
+	c := newConfig(opts...)
 
 	if err := SleepWithContext(c.ctx, c.sleeping); err != nil {
 		return err
@@ -87,9 +190,8 @@ func Wait4Port(addr string, opts ...Option) error {
 
 		resp, err := http.DefaultClient.Do(req)
 		if err != nil {
-			if c.verbose {
-				log.Println("could not connect to", addr, "yet, error", err, "retrying in", c.sleeping)
-			}
+			c.logger.Debug("could not connect yet", "addr", addr, "attempt", i+1, "error", err, "retry_in", c.sleeping)
+			c.observers.WaitRetry(addr, i+1, err)
 			if err := SleepWithContext(c.ctx, c.sleeping); err != nil {
 				return err
 			}
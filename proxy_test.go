@@ -0,0 +1,115 @@
+package playwrightcigo
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func Test_TransparentProxy(t *testing.T) {
+	t.Parallel()
+
+	errs := make(chan error, 1)
+	addr, port, close, err := transparentProxy("127.0.0.1", testcontainers.HostInternal, newConfig(WithSleeping(10*time.Millisecond)), errs)
+	require.NoError(t, err)
+
+	assert.Equal(t, "http://"+testcontainers.HostInternal+":"+strconv.Itoa(port), addr)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("Hello World!"))
+	}))
+	defer upstream.Close()
+
+	resp, err := proxyClient(t, port).Get(upstream.URL)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+	assert.Equal(t, "Hello World!", string(body))
+
+	close()
+
+	_, err = http.Get("http://127.0.0.1:" + strconv.Itoa(port))
+	assert.Error(t, err)
+
+	// Shutting down is not a serving failure.
+	select {
+	case err := <-errs:
+		t.Fatalf("unexpected proxy error: %v", err)
+	default:
+	}
+}
+
+func Test_TransparentProxyAllowed(t *testing.T) {
+	t.Parallel()
+
+	// Another address of the loopback stands for another container.
+	other := &net.TCPAddr{IP: net.ParseIP("127.0.0.2")}
+	if l, err := net.ListenTCP("tcp", other); err != nil {
+		t.Skipf("no other loopback address: %v", err)
+	} else {
+		_ = l.Close()
+	}
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("Hello World!"))
+	}))
+	t.Cleanup(upstream.Close)
+
+	tests := []struct {
+		name    string
+		allowed []netip.Addr
+		refused bool
+	}{
+		{name: "open", allowed: nil},
+		{name: "allowed", allowed: []netip.Addr{netip.MustParseAddr("127.0.0.2")}},
+		{name: "refused", allowed: []netip.Addr{netip.MustParseAddr("192.0.2.1")}, refused: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, port, close, err := transparentProxy("127.0.0.1", testcontainers.HostInternal, newConfig(WithSleeping(10*time.Millisecond)), make(chan error, 1), tt.allowed...)
+			require.NoError(t, err)
+			defer close()
+
+			client := proxyClient(t, port)
+			client.Transport.(*http.Transport).DialContext = (&net.Dialer{LocalAddr: other}).DialContext
+			defer client.CloseIdleConnections()
+			resp, err := client.Get(upstream.URL)
+			if tt.refused {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.NoError(t, resp.Body.Close())
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		})
+	}
+}
+
+// proxyClient returns an HTTP client going through the proxy listening on port.
+// Like browser contexts with IgnoreHttpsErrors, it accepts the certificates
+// of the proxy looking into HTTPS tunnels.
+func proxyClient(t *testing.T, port int) *http.Client {
+	t.Helper()
+
+	proxyURL, err := url.Parse("http://127.0.0.1:" + strconv.Itoa(port))
+	require.NoError(t, err)
+
+	return &http.Client{Transport: &http.Transport{
+		Proxy:           http.ProxyURL(proxyURL),
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, //nolint:gosec // The proxy signs its own certificates.
+	}}
+}
@@ -0,0 +1,77 @@
+package playwrightcigo
+
+import (
+	"fmt"
+	"maps"
+	"sync"
+)
+
+// BrowserSpec describes a browser server flavour the container image can run.
+//
+// The script is run as `node <Script> <proxy> <proxy port> <options>`, where
+// options is the JSON object of launchServer options, including the port and
+// wsPath to listen on. The scripts shipped in the image use launch.js to do
+// so, which custom scripts can import too.
+type BrowserSpec struct {
+	// Name identifies the browser in Launch, and is the WebSocket path of its server.
+	Name string
+	// Script is the file, relative to the image's working directory, starting the server.
+	Script string
+	// Port is the container port the server listens on when launched with default options.
+	Port int
+	// Type is the Playwright browser type to connect with: "chromium", "firefox" or "webkit".
+	Type string
+}
+
+var mutexRegistry sync.Mutex
+
+// registry holds the browser servers known to new sessions, by name.
+var registry = map[string]BrowserSpec{
+	"firefox":  {Name: "firefox", Script: "firefox.js", Port: 1024 + 1, Type: "firefox"},
+	"webkit":   {Name: "webkit", Script: "webkit.js", Port: 1024 + 2, Type: "webkit"},
+	"chromium": {Name: "chromium", Script: "chromium.js", Port: 1024 + 3, Type: "chromium"},
+}
+
+// RegisterBrowser makes a browser server flavour of a custom image, see
+// WithRepository, available to Launch under spec.Name.
+//
+// Sessions expose the ports of the browsers registered when they are
+// created, so register browsers before Install or New, typically from
+// TestMain or an init function.
+func RegisterBrowser(spec BrowserSpec) error {
+	switch {
+	case spec.Name == "":
+		return fmt.Errorf("could not register browser: no name")
+	case spec.Script == "":
+		return fmt.Errorf("could not register browser %s: no script", spec.Name)
+	case spec.Type != "chromium" && spec.Type != "firefox" && spec.Type != "webkit":
+		return fmt.Errorf("could not register browser %s: unknown type %q", spec.Name, spec.Type)
+	case spec.Port <= 0 || spec.Port > 65535:
+		return fmt.Errorf("could not register browser %s: port %d is out of valid range (1-65535)", spec.Name, spec.Port)
+	case spec.Port >= portPoolBase && spec.Port < portPoolBase+maxPortPool:
+		return fmt.Errorf("could not register browser %s: ports %d to %d are reserved for the port pool", spec.Name, portPoolBase, portPoolBase+maxPortPool-1)
+	}
+
+	mutexRegistry.Lock()
+	defer mutexRegistry.Unlock()
+
+	for _, registered := range registry {
+		if registered.Name == spec.Name {
+			return fmt.Errorf("could not register browser %s: already registered", spec.Name)
+		}
+		if registered.Port == spec.Port {
+			return fmt.Errorf("could not register browser %s: port %d is already used by %s", spec.Name, spec.Port, registered.Name)
+		}
+	}
+
+	registry[spec.Name] = spec
+	return nil
+}
+
+// registered returns a snapshot of the registry.
+func registered() map[string]BrowserSpec {
+	mutexRegistry.Lock()
+	defer mutexRegistry.Unlock()
+
+	return maps.Clone(registry)
+}
@@ -0,0 +1,57 @@
+package playwrightcigo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_RegisterBrowserInvalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		spec BrowserSpec
+		want string
+	}{
+		{"no name", BrowserSpec{Script: "x.js", Port: 2000, Type: "chromium"}, "no name"},
+		{"no script", BrowserSpec{Name: "x", Port: 2000, Type: "chromium"}, "no script"},
+		{"unknown type", BrowserSpec{Name: "x", Script: "x.js", Port: 2000, Type: "lynx"}, "unknown type"},
+		{"invalid port", BrowserSpec{Name: "x", Script: "x.js", Port: 70000, Type: "chromium"}, "out of valid range"},
+		{"reserved port", BrowserSpec{Name: "x", Script: "x.js", Port: portPoolBase, Type: "chromium"}, "reserved"},
+		{"taken name", BrowserSpec{Name: "chromium", Script: "x.js", Port: 2000, Type: "chromium"}, "already registered"},
+		{"taken port", BrowserSpec{Name: "x", Script: "x.js", Port: 1024 + 3, Type: "chromium"}, "already used by chromium"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := RegisterBrowser(test.spec)
+			assert.ErrorContains(t, err, test.want)
+		})
+	}
+}
+
+// Test_RegisterBrowser is not parallel: it changes the registry, which the
+// sessions of parallel tests snapshot once sequential ones are done.
+func Test_RegisterBrowser(t *testing.T) {
+	spec := BrowserSpec{Name: "chromium-extensions", Script: "chromium-extensions.js", Port: 1024 + 1000, Type: "chromium"}
+	require.NoError(t, RegisterBrowser(spec))
+	t.Cleanup(func() {
+		mutexRegistry.Lock()
+		defer mutexRegistry.Unlock()
+		delete(registry, spec.Name)
+	})
+
+	specs := registered()
+	assert.Equal(t, spec, specs["chromium-extensions"])
+	assert.Contains(t, exposedPorts(specs, defaultPortPool), "2024/tcp")
+
+	s := &Session{specs: specs}
+	b, err := s.server("chromium-extensions", LaunchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, spec, b.spec)
+	assert.Equal(t, 1024+1000, b.instancePort)
+}
@@ -0,0 +1,261 @@
+package playwrightcigo
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/elazarl/goproxy"
+)
+
+// ReplayPolicy tells what the proxy does with a request the HAR given to
+// WithHARReplay has no entry for.
+type ReplayPolicy int
+
+const (
+	// ReplayFail answers unmatched requests with 502 Bad Gateway, and makes
+	// Uninstall, or Session.Close, return an ErrReplayUnmatched error listing
+	// them.
+	ReplayFail ReplayPolicy = iota
+	// ReplayPassthrough forwards unmatched requests to their server.
+	ReplayPassthrough
+	// ReplayNotFound answers unmatched requests with 404 Not Found.
+	ReplayNotFound
+)
+
+// String returns the name of the policy.
+func (p ReplayPolicy) String() string {
+	switch p {
+	case ReplayFail:
+		return "fail"
+	case ReplayPassthrough:
+		return "passthrough"
+	case ReplayNotFound:
+		return "404"
+	default:
+		return fmt.Sprintf("ReplayPolicy(%d)", int(p))
+	}
+}
+
+// ErrReplayUnmatched is returned when the session closes if requests did not
+// match the HAR replayed with the ReplayFail policy.
+var ErrReplayUnmatched = errors.New("requests did not match the HAR")
+
+// replayer answers the requests going through a proxy from the entries of a
+// HAR file.
+type replayer struct {
+	path      string
+	policy    ReplayPolicy
+	matchBody bool
+
+	mutex     sync.Mutex
+	entries   map[string][]*harEntry
+	served    map[string]int
+	unmatched []string
+}
+
+// newReplayer loads the HAR file at path.
+func newReplayer(path string, policy ReplayPolicy, matchBody bool) (*replayer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read HAR: %w", err)
+	}
+	var file harFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("could not decode HAR %s: %w", path, err)
+	}
+
+	r := &replayer{
+		path:      path,
+		policy:    policy,
+		matchBody: matchBody,
+		entries:   map[string][]*harEntry{},
+		served:    map[string]int{},
+	}
+	for _, entry := range file.Log.Entries {
+		// Entries without a response, such as failed requests, answer nothing.
+		if entry == nil || entry.Response.Status == 0 {
+			continue
+		}
+		u, err := url.Parse(entry.Request.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid URL in HAR %s: %w", path, err)
+		}
+		var body []byte
+		if entry.Request.PostData != nil {
+			body, err = decodeHARText(entry.Request.PostData.Text, entry.Request.PostData.Encoding)
+			if err != nil {
+				return nil, fmt.Errorf("invalid request body in HAR %s: %w", path, err)
+			}
+		}
+		key := r.key(entry.Request.Method, u, body)
+		r.entries[key] = append(r.entries[key], entry)
+	}
+	return r, nil
+}
+
+// key identifies the requests answered by the same entries.
+func (r *replayer) key(method string, u *url.URL, body []byte) string {
+	key := method + " " + normalizeURL(u)
+	if r.matchBody {
+		key += "\n" + string(body)
+	}
+	return key
+}
+
+// tunnels lists the HTTPS hosts of the HAR, as CONNECT requests name them.
+func (r *replayer) tunnels() []string {
+	hosts := []string{}
+	for _, entries := range r.entries {
+		u, err := url.Parse(entries[0].Request.URL)
+		if err != nil || u.Scheme != "https" {
+			continue
+		}
+		host := u.Host
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "443")
+		}
+		if !slices.Contains(hosts, host) {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// replay registers the handlers answering the requests going through proxy.
+// Requests answered there are not forwarded, so handlers registered later do
+// not see them.
+// The requests through HTTPS tunnels are only seen when the proxy looks
+// into the tunnels to the hosts of the HAR, see mitm; the other tunnels are
+// refused, see refuse.
+func (r *replayer) replay(proxy *goproxy.ProxyHttpServer) {
+	proxy.OnRequest().DoFunc(func(req *http.Request, _ *goproxy.ProxyCtx) (*http.Request, *http.Response) {
+		var body []byte
+		if r.matchBody && req.Body != nil && req.Body != http.NoBody {
+			var err error
+			body, err = io.ReadAll(req.Body)
+			_ = req.Body.Close()
+			if err != nil {
+				return req, goproxy.NewResponse(req, goproxy.ContentTypeText, http.StatusBadGateway, fmt.Sprintf("could not read request body: %v", err))
+			}
+			req.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		if resp := r.answer(req, r.key(req.Method, req.URL, body)); resp != nil {
+			return req, resp
+		}
+		return req, r.miss(req)
+	})
+}
+
+// refuse registers the handler refusing the HTTPS tunnels the proxy does not
+// look into, with the response of the policy, unless it is ReplayPassthrough:
+// the requests through them could neither be answered nor reported. They are
+// noted as unmatched. It must be registered after mitm.
+func (r *replayer) refuse(proxy *goproxy.ProxyHttpServer) {
+	if r.policy == ReplayPassthrough {
+		return
+	}
+	proxy.OnRequest().HandleConnectFunc(func(host string, ctx *goproxy.ProxyCtx) (*goproxy.ConnectAction, string) {
+		r.mutex.Lock()
+		r.unmatched = append(r.unmatched, http.MethodConnect+" "+host)
+		r.mutex.Unlock()
+
+		ctx.Resp = r.miss(ctx.Req)
+		return goproxy.RejectConnect, host
+	})
+}
+
+// miss returns the response of the policy to a request that matched no
+// entry, or nil to forward it.
+func (r *replayer) miss(req *http.Request) *http.Response {
+	switch r.policy {
+	case ReplayPassthrough:
+		return nil
+	case ReplayNotFound:
+		return goproxy.NewResponse(req, goproxy.ContentTypeText, http.StatusNotFound, "not found in HAR "+r.path)
+	default:
+		return goproxy.NewResponse(req, goproxy.ContentTypeText, http.StatusBadGateway, "not found in HAR "+r.path)
+	}
+}
+
+// answer returns the response recorded for key, or nil after noting the
+// request as unmatched. Requests recorded several times are answered in
+// order, the last response being repeated.
+func (r *replayer) answer(req *http.Request, key string) *http.Response {
+	r.mutex.Lock()
+	entries := r.entries[key]
+	if len(entries) == 0 {
+		r.unmatched = append(r.unmatched, req.Method+" "+normalizeURL(req.URL))
+		r.mutex.Unlock()
+		return nil
+	}
+	entry := entries[min(r.served[key], len(entries)-1)]
+	r.served[key]++
+	r.mutex.Unlock()
+
+	body, err := decodeHARText(entry.Response.Content.Text, entry.Response.Content.Encoding)
+	if err != nil {
+		return goproxy.NewResponse(req, goproxy.ContentTypeText, http.StatusBadGateway, fmt.Sprintf("invalid response body in HAR %s: %v", r.path, err))
+	}
+
+	header := http.Header{}
+	for _, h := range entry.Response.Headers {
+		header.Add(h.Name, h.Value)
+	}
+	// The body is recorded decoded, and its length is the one replayed.
+	header.Del("Content-Encoding")
+	header.Del("Content-Length")
+	header.Del("Transfer-Encoding")
+
+	status := http.StatusText(entry.Response.Status)
+	if entry.Response.StatusText != "" {
+		status = entry.Response.StatusText
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", entry.Response.Status, status),
+		StatusCode:    entry.Response.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// report returns the requests that did not match the HAR, as an
+// ErrReplayUnmatched error with the ReplayFail policy. With the others, they
+// are only logged.
+func (r *replayer) report(c *config) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if len(r.unmatched) == 0 {
+		return nil
+	}
+	if r.policy != ReplayFail {
+		c.logger.Warn("requests did not match the HAR", "har", r.path, "policy", r.policy.String(), "count", len(r.unmatched), "requests", strings.Join(r.unmatched, ", "))
+		return nil
+	}
+	return fmt.Errorf("%w %s: %d of them:\n\t%s", ErrReplayUnmatched, r.path, len(r.unmatched), strings.Join(r.unmatched, "\n\t"))
+}
+
+// decodeHARText returns the bytes of a HAR text, see harText.
+func decodeHARText(text, encoding string) ([]byte, error) {
+	if encoding == "base64" {
+		return base64.StdEncoding.DecodeString(text)
+	}
+	return []byte(text), nil
+}
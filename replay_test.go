@@ -0,0 +1,149 @@
+package playwrightcigo
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func Test_HARReplay(t *testing.T) {
+	t.Parallel()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("upstream"))
+	}))
+	t.Cleanup(upstream.Close)
+	secure := httptest.NewTLSServer(upstream.Config.Handler)
+	t.Cleanup(secure.Close)
+
+	entry := func(method, url, body string, status int, content string) *harEntry {
+		e := &harEntry{
+			Request: harRequest{Method: method, URL: url},
+			Response: harResponse{
+				Status:  status,
+				Headers: []harNameValue{{Name: "Content-Type", Value: "text/plain"}, {Name: "Content-Length", Value: "1000"}},
+				Content: harContent{Text: content},
+			},
+		}
+		if body != "" {
+			e.Request.PostData = &harPostData{Text: body}
+		}
+		return e
+	}
+	data, err := json.Marshal(harFile{Log: harLog{Version: "1.2", Entries: []*harEntry{
+		entry(http.MethodGet, "http://app.test/api?page=1", "", http.StatusOK, "first"),
+		entry(http.MethodGet, "http://app.test/api?page=1", "", http.StatusOK, "second"),
+		entry(http.MethodPost, "http://app.test/search", `{"q":"tea"}`, http.StatusCreated, "tea"),
+		entry(http.MethodPost, "http://app.test/search", `{"q":"coffee"}`, http.StatusCreated, "coffee"),
+	}}})
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "app.har")
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+
+	get := func(t *testing.T, client *http.Client, method, url, body string) (int, string) {
+		t.Helper()
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		require.NoError(t, err)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(data)
+	}
+
+	tests := []struct {
+		name      string
+		opts      []Option
+		unmatched int
+		body      string
+		err       bool
+	}{
+		{name: "fail", opts: []Option{WithHARReplay(path, ReplayFail)}, unmatched: http.StatusBadGateway, body: "not found in HAR " + path, err: true},
+		{name: "passthrough", opts: []Option{WithHARReplay(path, ReplayPassthrough)}, unmatched: http.StatusOK, body: "upstream"},
+		{name: "404", opts: []Option{WithHARReplay(path, ReplayNotFound)}, unmatched: http.StatusNotFound, body: "not found in HAR " + path},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			errs := make(chan error, 1)
+			opts := append([]Option{WithSleeping(10 * time.Millisecond), WithLogger(TestLogger(t))}, tt.opts...)
+			_, port, close, err := transparentProxy("127.0.0.1", testcontainers.HostInternal, newConfig(opts...), errs)
+			require.NoError(t, err)
+			client := proxyClient(t, port)
+
+			// Responses recorded several times are replayed in order.
+			for _, want := range []string{"first", "second", "second"} {
+				status, body := get(t, client, http.MethodGet, "http://app.test/api?page=1", "")
+				assert.Equal(t, http.StatusOK, status)
+				assert.Equal(t, want, body)
+			}
+			// Bodies are not matched by default.
+			status, body := get(t, client, http.MethodPost, "http://app.test/search", `{"q":"milk"}`)
+			assert.Equal(t, http.StatusCreated, status)
+			assert.Equal(t, "tea", body)
+
+			status, body = get(t, client, http.MethodGet, upstream.URL+"/missing", "")
+			assert.Equal(t, tt.unmatched, status)
+			assert.Equal(t, tt.body, body)
+
+			// The tunnels to the hosts the HAR does not know are refused
+			// with the same status, unless they pass through.
+			resp, err := client.Get(secure.URL + "/missing")
+			if tt.unmatched == http.StatusOK {
+				require.NoError(t, err)
+				require.NoError(t, resp.Body.Close())
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), http.StatusText(tt.unmatched))
+			}
+			client.CloseIdleConnections()
+
+			err = close()
+			if !tt.err {
+				assert.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, ErrReplayUnmatched)
+			assert.Contains(t, err.Error(), "GET "+upstream.URL+"/missing")
+			assert.Contains(t, err.Error(), "CONNECT "+secure.Listener.Addr().String())
+		})
+	}
+
+	t.Run("body", func(t *testing.T) {
+		t.Parallel()
+
+		errs := make(chan error, 1)
+		_, port, close, err := transparentProxy("127.0.0.1", testcontainers.HostInternal, newConfig(WithSleeping(10*time.Millisecond), WithHARReplay(path, ReplayNotFound), WithHARReplayBody()), errs)
+		require.NoError(t, err)
+		defer close()
+		client := proxyClient(t, port)
+
+		status, body := get(t, client, http.MethodPost, "http://app.test/search", `{"q":"coffee"}`)
+		assert.Equal(t, http.StatusCreated, status)
+		assert.Equal(t, "coffee", body)
+
+		status, _ = get(t, client, http.MethodPost, "http://app.test/search", `{"q":"milk"}`)
+		assert.Equal(t, http.StatusNotFound, status)
+	})
+}
+
+func Test_HARReplayMissing(t *testing.T) {
+	t.Parallel()
+
+	errs := make(chan error, 1)
+	_, _, _, err := transparentProxy("127.0.0.1", testcontainers.HostInternal, newConfig(WithHARReplay(filepath.Join(t.TempDir(), "missing.har"), ReplayFail)), errs)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
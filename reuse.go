@@ -0,0 +1,163 @@
+package playwrightcigo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	dockercontainer "github.com/moby/moby/api/types/container"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// A container shared with WithReuse is used by at most reuseSlots processes
+// at once, each taking its own range of reuseSlotPorts ports from the pool.
+const (
+	reuseSlots     = 8
+	reuseSlotPorts = defaultPortPool
+)
+
+// reuse finds the container shared under the name given to WithReuse, or
+// starts it, and attaches to it. It returns errNoSlot when the container has
+// no room left for this process.
+//
+// The container lives as long as ctx, while start bounds starting it.
+func reuse(ctx, start context.Context, cancel func(), c *config, image string, specs map[string]BrowserSpec, errs chan<- error) (*container, error) {
+	unlock, err := lockFile(filepath.Join(os.TempDir(), "playwright-ci-go-"+c.reuse+".lock"))
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("could not lock shared container %s: %w", c.reuse, err)
+	}
+	defer unlock()
+
+	// Let the first process take its lease before the container stops.
+	idle := max(leaseSeconds(c.idle), leaseSeconds(c.lease))
+	req := testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        image,
+			Name:         "playwright-ci-go-" + c.reuse,
+			WorkingDir:   "/src",
+			ExposedPorts: exposedPorts(specs, reuseSlots*reuseSlotPorts),
+			Cmd:          []string{lifetime, "playwright-ci-go", leaseDir, strconv.Itoa(idle)},
+			WaitingFor:   wait.ForExec([]string{"test", "-d", leaseDir + "/slots"}),
+			ConfigModifier: func(config *dockercontainer.Config) {
+				// The container outlives this process, so the reaper must
+				// not terminate it along with the process' other ones.
+				delete(config.Labels, "org.testcontainers.sessionId")
+				delete(config.Labels, "org.testcontainers.reap")
+			},
+		},
+		Started: true,
+		Reuse:   true,
+	}
+
+	for i := 0; ; i++ {
+		c.logger.Debug("attaching to shared browser container", "name", req.Name, "attempt", i+1)
+		browsers, err := testcontainers.GenericContainer(start, req)
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("could not start shared browser container: %w", err)
+		}
+
+		inspect, err := browsers.Inspect(start)
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("could not inspect shared browser container: %w", err)
+		}
+		if inspect.Config.Image != image {
+			cancel()
+			return nil, fmt.Errorf("shared browser container %s runs %s instead of %s, pick another name for WithReuse", inspect.Name, inspect.Config.Image, image)
+		}
+
+		shared := &container{
+			context:   ctx,
+			browsers:  browsers,
+			image:     image,
+			observer:  c.observers,
+			log:       c.logger.With("container_id", browsers.GetContainerID()),
+			output:    c.output,
+			terminate: cancel,
+			shared:    true,
+		}
+		err = shared.attach(start, reuseSlots, c.lease, errs)
+		if errors.Is(err, errClosing) && i < c.retry {
+			// Once stopped, the container is started again.
+			if err := SleepWithContext(start, time.Second); err != nil {
+				cancel()
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			if !errors.Is(err, errNoSlot) {
+				cancel()
+			}
+			return nil, err
+		}
+
+		if err := shared.reclaim(start, portPoolBase+shared.slot*reuseSlotPorts, reuseSlotPorts); err != nil {
+			_ = shared.detach()
+			cancel()
+			return nil, err
+		}
+
+		if err := shared.startProxy(start, c, errs); err != nil {
+			_ = shared.detach()
+			cancel()
+			return nil, err
+		}
+		return shared, nil
+	}
+}
+
+// startProxy starts the transparent proxy of this process for a shared
+// container. The container was started by another process, so it reaches the
+// proxy through its network gateway rather than a forwarded host port.
+func (c *container) startProxy(ctx context.Context, cfg *config, errs chan<- error) error {
+	inspect, err := c.browsers.Inspect(ctx)
+	if err != nil {
+		return fmt.Errorf("could not inspect shared browser container: %w", err)
+	}
+
+	// On Linux the gateway is an address of the host, only reachable from
+	// the containers. Elsewhere, Docker runs in a VM and forwards its
+	// host.docker.internal to the host loopback.
+	listen, host := "127.0.0.1", "host.docker.internal"
+	for _, network := range inspect.NetworkSettings.Networks {
+		if !network.Gateway.IsValid() {
+			continue
+		}
+		gateway := network.Gateway.String()
+		if l, err := net.Listen("tcp", net.JoinHostPort(gateway, "0")); err == nil {
+			_ = l.Close()
+			listen, host = gateway, gateway
+			break
+		}
+	}
+
+	// The other containers of the network reach the gateway too: only the
+	// shared container may use the proxy.
+	allowed := []netip.Addr{}
+	if listen != "127.0.0.1" {
+		allowed = append(allowed, netip.MustParseAddr(listen))
+		for _, network := range inspect.NetworkSettings.Networks {
+			for _, addr := range []netip.Addr{network.IPAddress, network.GlobalIPv6Address} {
+				if addr.IsValid() {
+					allowed = append(allowed, addr.Unmap())
+				}
+			}
+		}
+	}
+
+	c.proxy, c.proxyPort, c.proxyClose, err = transparentProxy(listen, host, cfg, errs, allowed...)
+	if err != nil {
+		return fmt.Errorf("could not start transparent proxy: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package playwrightcigo
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// servedHosts numbers the hostnames handlers are served under, see Serve.
+var servedHosts atomic.Int64
+
+// Serve serves handler to the browsers of the session under a hostname of its
+// own and returns its base URL, such as "http://serve-1.playwright-ci-go.test".
+// Requests are dispatched to handler by the proxy, in the process, so there is
+// no port to open nor to wait for. handler is served until the session closes;
+// see the Serve function to stop serving it at the end of a test.
+//
+// Responses are streamed as handler writes them, but handler cannot hijack
+// the connection, so it cannot serve WebSockets.
+func (s *Session) Serve(handler http.Handler) string {
+	baseURL, _ := s.serve(handler)
+	return baseURL
+}
+
+// serve serves handler like Serve, and returns a function to stop serving it.
+func (s *Session) serve(handler http.Handler) (string, func()) {
+	host := fmt.Sprintf("serve-%d.playwright-ci-go.test", servedHosts.Add(1))
+	stop := s.Proxy().OnRequest(Host(host)).Handle(handler)
+	return "http://" + host, stop
+}
+
+// serveInProcess runs handler for req and returns its response as soon as its
+// header is written, its body being streamed from handler.
+func serveInProcess(handler http.Handler, req *http.Request) *http.Response {
+	body, w := io.Pipe()
+	rw := &pipeResponseWriter{
+		header: http.Header{},
+		body:   w,
+		ready:  make(chan struct{}),
+		resp: &http.Response{
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Body:       body,
+			Request:    req,
+		},
+	}
+
+	go func() {
+		defer func() {
+			if v := recover(); v != nil {
+				rw.WriteHeader(http.StatusInternalServerError)
+				rw.commit(nil)
+				_ = w.CloseWithError(fmt.Errorf("handler panicked: %v", v))
+				return
+			}
+			rw.commit(nil)
+			_ = w.Close()
+		}()
+		handler.ServeHTTP(rw, req)
+	}()
+
+	<-rw.ready
+	return rw.resp
+}
+
+// pipeResponseWriter writes the response of a handler served in the process
+// to a pipe, like an http.Server would to the connection: the header is
+// committed on the first write, with the content type sniffed if not set.
+type pipeResponseWriter struct {
+	header http.Header
+	body   *io.PipeWriter
+	status int
+
+	once  sync.Once
+	ready chan struct{}
+	resp  *http.Response
+}
+
+var _ http.Flusher = (*pipeResponseWriter)(nil)
+
+func (w *pipeResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *pipeResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *pipeResponseWriter) Write(p []byte) (int, error) {
+	w.commit(p)
+	return w.body.Write(p)
+}
+
+// Flush commits the header, the body being written as it comes.
+func (w *pipeResponseWriter) Flush() {
+	w.commit(nil)
+}
+
+// commit completes the response with the header written so far, once.
+// data is the beginning of the body, to sniff its content type from.
+func (w *pipeResponseWriter) commit(data []byte) {
+	w.once.Do(func() {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		header := w.header.Clone()
+		if header.Get("Content-Type") == "" && len(data) > 0 {
+			header.Set("Content-Type", http.DetectContentType(data))
+		}
+
+		w.resp.StatusCode = w.status
+		w.resp.Status = fmt.Sprintf("%d %s", w.status, http.StatusText(w.status))
+		w.resp.Header = header
+		w.resp.ContentLength = -1
+		if length, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64); err == nil {
+			w.resp.ContentLength = length
+		}
+		close(w.ready)
+	})
+}
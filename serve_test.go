@@ -0,0 +1,125 @@
+package playwrightcigo
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func Test_Serve(t *testing.T) {
+	t.Parallel()
+
+	c := newConfig(WithSleeping(10 * time.Millisecond))
+	s := &Session{config: c}
+	errs := make(chan error, 1)
+	_, port, close, err := transparentProxy("127.0.0.1", testcontainers.HostInternal, c, errs)
+	require.NoError(t, err)
+	defer close()
+	client := proxyClient(t, port)
+	// The proxy waits for the connections the client opened to stop.
+	defer client.CloseIdleConnections()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("<html><body>Hello " + r.Host + "</body></html>"))
+	})
+	baseURL, stop := s.serve(mux)
+	other := s.Serve(http.NotFoundHandler())
+	assert.NotEqual(t, baseURL, other)
+	// Answers what is no longer served, before the proxy looks the host up.
+	c.proxy.OnRequest().Handle(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGone)
+	}))
+
+	resp, err := client.Get(baseURL + "/")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "<html><body>Hello "+baseURL[len("http://"):]+"</body></html>", string(body))
+
+	resp, err = client.Get(other + "/")
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// Once stopped, the hostname is no longer served.
+	stop()
+	resp, err = client.Get(baseURL + "/")
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusGone, resp.StatusCode)
+}
+
+func Test_ServeInProcess(t *testing.T) {
+	t.Parallel()
+
+	t.Run("stream", func(t *testing.T) {
+		t.Parallel()
+
+		next := make(chan struct{})
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = w.Write([]byte("data: first\n"))
+			w.(http.Flusher).Flush()
+			<-next
+			_, _ = w.Write([]byte("data: second\n"))
+		})
+
+		resp := serveInProcess(handler, httptest.NewRequest(http.MethodGet, "http://app.test/events", nil))
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+		assert.Equal(t, "202 Accepted", resp.Status)
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+		assert.Equal(t, int64(-1), resp.ContentLength)
+
+		// The first event is there before the handler writes the second one.
+		lines := bufio.NewReader(resp.Body)
+		line, err := lines.ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, "data: first\n", line)
+		close(next)
+		rest, err := io.ReadAll(lines)
+		require.NoError(t, err)
+		assert.Equal(t, "data: second\n", string(rest))
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		t.Parallel()
+
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Length", "0")
+			w.WriteHeader(http.StatusNoContent)
+		})
+		resp := serveInProcess(handler, httptest.NewRequest(http.MethodGet, "http://app.test/", nil))
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+		assert.Equal(t, int64(0), resp.ContentLength)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Empty(t, body)
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		t.Parallel()
+
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		})
+		resp := serveInProcess(handler, httptest.NewRequest(http.MethodGet, "http://app.test/", nil))
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+		_, err := io.ReadAll(resp.Body)
+		assert.ErrorContains(t, err, "handler panicked: boom")
+	})
+}
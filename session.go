@@ -0,0 +1,240 @@
+package playwrightcigo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/containerd/errdefs"
+	"github.com/mxschmitt/playwright-go"
+)
+
+// Session is an independent containerized Playwright environment.
+// Each session owns its browser container, transparent proxy and Playwright
+// driver, so several sessions with different options (for example two image
+// tags) can run side by side in the same test binary.
+//
+// Install and Uninstall manage a default session shared by the package-level
+// browser functions; use New when you need more than one.
+type Session struct {
+	mutex        sync.Mutex
+	mutexBrowser sync.Mutex
+
+	config    *config
+	pw        *playwright.Playwright
+	container *container
+
+	// errs receives the failures of the processes the session depends on,
+	// such as its proxy, which fail every launch from then on; broken keeps
+	// them, and failures them and the crashes of browser servers for Err.
+	errs     chan error
+	failures []error
+	broken   []error
+
+	// specs holds the browsers registered when the session was created,
+	// servers the browser servers by name and launch options, and ports the
+	// container ports they listen on.
+	specs     map[string]BrowserSpec
+	servers   map[string]*browser
+	ports     map[int]bool
+	dedicated int
+
+	// shared is set when the container is shared with other processes, see
+	// WithReuse: all servers then listen on the ports of slot.
+	shared bool
+	slot   int
+
+	// connections maps the browsers connected to the servers to the run of
+	// the server they are connected to, see BrowserErr.
+	connections map[playwright.Browser]connection
+}
+
+// New creates a Session: it installs the Playwright driver and starts a
+// container to run the browsers.
+// Options can be provided to customize the session.
+// Call Close when you are done with the session.
+func New(opts ...Option) (*Session, error) {
+	c := newConfig(opts...)
+
+	driver, err := playwright.NewDriver(&playwright.RunOptions{SkipInstallBrowsers: true, Verbose: c.debug()})
+	if err != nil {
+		return nil, fmt.Errorf("error while setting up driver: %w", err)
+	}
+
+	if err := driver.Install(); err != nil {
+		return nil, fmt.Errorf("error while installing driver: %w", err)
+	}
+
+	pw, err := playwright.Run()
+	if err != nil {
+		return nil, fmt.Errorf("error while starting to run playwright: %w", err)
+	}
+
+	errs := make(chan error, 16)
+	specs := registered()
+
+	browsers, err := new(c, specs, errs)
+	if err != nil {
+		_ = pw.Stop()
+		return nil, err
+	}
+
+	s := &Session{
+		config:    c,
+		pw:        pw,
+		container: browsers,
+		errs:      errs,
+		specs:     specs,
+		shared:    browsers.shared,
+		slot:      browsers.slot,
+	}
+
+	return s, nil
+}
+
+// Close stops the browsers, the container and the Playwright driver of the session.
+// Browsers obtained from the session must not be used after Close; those
+// never closed are logged.
+func (s *Session) Close() error {
+	s.mutex.Lock()
+	browsers := s.container
+	s.container = nil
+	s.mutex.Unlock()
+
+	if browsers == nil {
+		return nil
+	}
+
+	s.mutexBrowser.Lock()
+	if leaks := s.leaks(); len(leaks) > 0 {
+		s.logger().Warn("browsers were never closed", "count", len(leaks), "launched_at", strings.Join(leaks, ", "))
+	}
+	stops := []func(){}
+	for _, b := range slices.Collect(maps.Values(s.servers)) {
+		stops = append(stops, b.shutdown())
+	}
+	s.mutexBrowser.Unlock()
+	for _, stop := range stops {
+		stop()
+	}
+
+	// The driver is stopped whatever happened to the container.
+	var failures []error
+	if err := browsers.Close(); errors.Is(err, ErrReplayUnmatched) {
+		failures = append(failures, err)
+	} else if err != nil {
+		// Ignore "not found" errors since the container may have already been terminated due to timeout or other cleanup.
+		if !errdefs.IsNotFound(err) {
+			failures = append(failures, fmt.Errorf("could not close container: %w", err))
+		} else {
+			s.logger().Info("container already closed or not found, ignoring error", "error", err)
+		}
+	}
+
+	if err := s.pw.Stop(); err != nil {
+		failures = append(failures, fmt.Errorf("could not stop playwright: %w", err))
+	}
+	return errors.Join(failures...)
+}
+
+// Err returns the failures of the processes the session runs in the
+// background, such as a *BrowserServerError when a browser server crashed,
+// or nil if there were none.
+func (s *Session) Err() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.collect()
+	return errors.Join(s.failures...)
+}
+
+// brokenErr returns the failures of the processes the session depends on,
+// which fail every launch.
+func (s *Session) brokenErr() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.collect()
+	return errors.Join(s.broken...)
+}
+
+// fail records the failure of a browser server, which is relaunched on the
+// next launch rather than failing it: it is only returned by Err and by
+// BrowserErr for the browsers connected to it.
+func (s *Session) fail(err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.collect()
+	s.failures = append(s.failures, err)
+}
+
+// collect moves the errors waiting in the channel to the session.
+// It must be called with the session mutex held.
+func (s *Session) collect() {
+	for {
+		select {
+		case err := <-s.errs:
+			s.failures = append(s.failures, err)
+			s.broken = append(s.broken, err)
+		default:
+			return
+		}
+	}
+}
+
+// logger returns the logger of the session.
+func (s *Session) logger() *slog.Logger {
+	if s.config == nil {
+		return slog.Default()
+	}
+	return s.config.logger
+}
+
+// running returns the session's container, or nil once the session is closed.
+func (s *Session) running() *container {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.container
+}
+
+// Chromium launches a Chromium browser instance in the session's container.
+// See the package-level Chromium for details.
+func (s *Session) Chromium() (playwright.Browser, error) {
+	return s.ChromiumContext(context.Background())
+}
+
+// ChromiumContext launches a Chromium browser instance in the session's container.
+// See the package-level ChromiumContext for details.
+func (s *Session) ChromiumContext(ctx context.Context) (playwright.Browser, error) {
+	return s.LaunchContext(ctx, "chromium")
+}
+
+// Firefox launches a Firefox browser instance in the session's container.
+// See the package-level Firefox for details.
+func (s *Session) Firefox() (playwright.Browser, error) {
+	return s.FirefoxContext(context.Background())
+}
+
+// FirefoxContext launches a Firefox browser instance in the session's container.
+// See the package-level FirefoxContext for details.
+func (s *Session) FirefoxContext(ctx context.Context) (playwright.Browser, error) {
+	return s.LaunchContext(ctx, "firefox")
+}
+
+// Webkit launches a WebKit browser instance in the session's container.
+// See the package-level Webkit for details.
+func (s *Session) Webkit() (playwright.Browser, error) {
+	return s.WebkitContext(context.Background())
+}
+
+// WebkitContext launches a WebKit browser instance in the session's container.
+// See the package-level WebkitContext for details.
+func (s *Session) WebkitContext(ctx context.Context) (playwright.Browser, error) {
+	return s.LaunchContext(ctx, "webkit")
+}
@@ -0,0 +1,158 @@
+package playwrightcigo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mxschmitt/playwright-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_SessionErr(t *testing.T) {
+	t.Parallel()
+
+	s := &Session{errs: make(chan error, 2)}
+	assert.NoError(t, s.Err())
+	assert.NoError(t, s.brokenErr())
+
+	// A crashed server only fails the browsers connected to it...
+	crash := &BrowserServerError{Browser: "chromium", ExitCode: 1, Output: "boom"}
+	s.fail(crash)
+	assert.NoError(t, s.brokenErr())
+	var serverErr *BrowserServerError
+	assert.True(t, errors.As(s.Err(), &serverErr))
+	assert.Equal(t, "chromium", serverErr.Browser)
+	assert.Equal(t, 1, serverErr.ExitCode)
+
+	// ...while a failing proxy fails every launch...
+	proxy := errors.New("error serving proxy")
+	s.errs <- proxy
+	assert.ErrorIs(t, s.brokenErr(), proxy)
+	assert.ErrorIs(t, s.brokenErr(), proxy)
+	assert.NotErrorIs(t, s.brokenErr(), crash)
+
+	// ...and Err keeps reporting both.
+	assert.ErrorIs(t, s.Err(), crash)
+	assert.ErrorIs(t, s.Err(), proxy)
+}
+
+func Test_BrowserServerError(t *testing.T) {
+	t.Parallel()
+
+	exited := &BrowserServerError{Browser: "firefox", ExitCode: 137, Output: "killed"}
+	assert.Equal(t, "firefox browser server exited with code 137: killed", exited.Error())
+	assert.Nil(t, errors.Unwrap(exited))
+
+	cause := errors.New("no such container")
+	failed := &BrowserServerError{Browser: "webkit", ExitCode: -1, Err: cause}
+	assert.Equal(t, "webkit browser server failed: no such container", failed.Error())
+	assert.ErrorIs(t, failed, cause)
+}
+
+func Test_SessionLaunchContext(t *testing.T) {
+	t.Parallel()
+
+	s := &Session{specs: registered()}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := s.ChromiumContext(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorContains(t, err, "chromium")
+
+	// Without a container there is nothing to launch.
+	_, err = s.Chromium()
+	assert.ErrorContains(t, err, "container is not running")
+}
+
+func Test_LaunchWhileStarting(t *testing.T) {
+	t.Parallel()
+
+	s := &Session{specs: registered()}
+	s.mutexBrowser.Lock()
+	b, err := s.server("chromium", LaunchOptions{})
+	s.mutexBrowser.Unlock()
+	require.NoError(t, err)
+
+	// Another launch is starting the Chromium server.
+	b.starting <- struct{}{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	waiting := make(chan error)
+	go func() {
+		_, err := s.ChromiumContext(ctx)
+		waiting <- err
+	}()
+	assert.Eventually(t, func() bool {
+		s.mutexBrowser.Lock()
+		defer s.mutexBrowser.Unlock()
+		return b.count == 1
+	}, time.Second, time.Millisecond)
+
+	// Launching other browsers does not wait for it...
+	_, err = s.Firefox()
+	assert.ErrorContains(t, err, "container is not running")
+
+	// ...and the waiting launch gives up with its context, releasing the
+	// server that did not start.
+	cancel()
+	assert.ErrorIs(t, <-waiting, context.Canceled)
+	s.mutexBrowser.Lock()
+	defer s.mutexBrowser.Unlock()
+	assert.Equal(t, 0, b.count)
+	assert.Empty(t, s.servers)
+	assert.Empty(t, s.ports)
+}
+
+func Test_BrowserServerErrorChannel(t *testing.T) {
+	t.Parallel()
+
+	err := &BrowserServerError{Browser: "chromium", ExitCode: exitChannelUnavailable, Output: "Chromium distribution 'msedge' is not found", Err: ErrChannelUnavailable}
+	assert.ErrorIs(t, err, ErrChannelUnavailable)
+	assert.Contains(t, err.Error(), "msedge")
+}
+
+func Test_BrowserRestart(t *testing.T) {
+	t.Parallel()
+
+	s := &Session{specs: registered(), config: newConfig(WithMaxRestarts(1))}
+	s.mutexBrowser.Lock()
+	b, err := s.server("chromium", LaunchOptions{})
+	require.NoError(t, err)
+	stopped := 0
+	b.count = 1
+	b.stop = func() { stopped++ }
+
+	lost := &struct{ playwright.Browser }{}
+	s.connections = map[playwright.Browser]connection{lost: {server: b, generation: 0}}
+
+	crash := &BrowserServerError{Browser: "chromium", ExitCode: 137, Output: "Killed"}
+	b.died(0, crash)
+	s.mutexBrowser.Unlock()
+
+	// The dead server is relaunched, which needs a container...
+	_, err = s.Chromium()
+	assert.ErrorIs(t, err, crash)
+	assert.ErrorContains(t, err, "container is not running")
+	assert.Equal(t, 1, stopped)
+
+	// ...and once the budget is spent, launches fail.
+	_, err = s.Chromium()
+	assert.ErrorIs(t, err, ErrRestartBudget)
+	assert.Equal(t, 1, stopped)
+
+	s.mutexBrowser.Lock()
+	assert.Equal(t, 1, b.restarts)
+	assert.Equal(t, 1, b.count)
+	// The failed relaunch left nothing to stop.
+	assert.False(t, b.running())
+	s.mutexBrowser.Unlock()
+
+	// The browser connected to the first run learns why it was lost.
+	assert.ErrorIs(t, s.BrowserErr(lost), crash)
+	assert.NoError(t, s.BrowserErr(&struct{ playwright.Browser }{}))
+}
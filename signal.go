@@ -0,0 +1,79 @@
+package playwrightcigo
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// handleSignals tears the default session down when the process receives
+// SIGINT or SIGTERM, within timeout, then raises the signal again.
+// It returns a function removing the handler.
+func handleSignals(timeout time.Duration) func() {
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case <-done:
+		case sig := <-signals:
+			// Restore the default behavior before raising the signal again.
+			signal.Stop(signals)
+			interrupt(timeout)
+			raise(sig)
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
+
+// interrupt closes the default session whatever the count of Install calls,
+// giving up after timeout.
+func interrupt(timeout time.Duration) {
+	mutex.Lock()
+	s := session
+	session = nil
+	count = 0
+	interrupted = true
+	stopSignals = nil
+	mutex.Unlock()
+
+	if s == nil {
+		return
+	}
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- s.Close()
+	}()
+
+	select {
+	case err := <-closed:
+		if err != nil {
+			s.logger().Error("could not uninstall playwright-ci-go", "error", err)
+		}
+	case <-time.After(timeout):
+		s.logger().Error("could not uninstall playwright-ci-go: timed out", "timeout", timeout)
+	}
+}
+
+// raise delivers sig to the process again. Where that is not supported, the
+// process exits with the conventional 128+signal code instead.
+func raise(sig os.Signal) {
+	p, err := os.FindProcess(os.Getpid())
+	if err == nil {
+		err = p.Signal(sig)
+	}
+	if err == nil {
+		return
+	}
+	if s, ok := sig.(syscall.Signal); ok {
+		os.Exit(128 + int(s))
+	}
+	os.Exit(1)
+}
@@ -0,0 +1,46 @@
+package playwrightcigo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test_Interrupt is not parallel: it changes the default session, which
+// parallel tests only use once sequential ones are done.
+func Test_Interrupt(t *testing.T) {
+	mutex.Lock()
+	session = &Session{}
+	count = 2
+	stop := handleSignals(time.Second)
+	stopSignals = stop
+	mutex.Unlock()
+	// interrupt forgets the handler, which no signal triggered.
+	t.Cleanup(stop)
+
+	interrupt(time.Second)
+
+	mutex.Lock()
+	assert.Nil(t, session)
+	assert.Zero(t, count)
+	assert.Nil(t, stopSignals)
+	mutex.Unlock()
+
+	// The Uninstall calls still pending are no-ops...
+	assert.NoError(t, Uninstall())
+	assert.NoError(t, Uninstall())
+
+	// ...until the next Install.
+	mutex.Lock()
+	interrupted = false
+	mutex.Unlock()
+	assert.EqualError(t, Uninstall(), "playwright-ci-go is not installed")
+}
+
+func Test_MainSignalHandler(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, defaultSignalTimeout, newConfig(mainOptions(nil)...).signals)
+	assert.Equal(t, time.Second, newConfig(mainOptions([]Option{WithSignalHandler(time.Second)})...).signals)
+}
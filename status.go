@@ -0,0 +1,222 @@
+package playwrightcigo
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/testcontainers/testcontainers-go"
+)
+
+// Status describes what a session runs, for instance to dump it when a CI job
+// fails.
+type Status struct {
+	// ContainerID identifies the browser container, Shared is set when it is
+	// shared with other processes, see WithReuse.
+	ContainerID string
+	Shared      bool
+
+	// Image is the reference of the container image, ImageDigest its repository
+	// digest, or its ID when it has none, such as a locally built image.
+	Image       string
+	ImageDigest string
+
+	// Tag is the image tag, and TagSource how it was resolved: TagFromOption,
+	// TagFromBuildInfo, TagFromGoList or TagFromGit.
+	Tag       string
+	TagSource string
+
+	// Proxy is the URL of the transparent proxy, as the browsers reach it.
+	Proxy string
+
+	// Ports maps the container ports exposed for browser servers to the host
+	// ports they are reachable on.
+	Ports map[int]int
+
+	// Browsers lists the browser servers, sorted by name and port.
+	Browsers []BrowserStatus
+}
+
+// BrowserStatus describes a browser server.
+type BrowserStatus struct {
+	// Name is the browser, as given to Launch, and Key tells the servers of
+	// the same browser with different launch options apart.
+	Name string
+	Key  string
+
+	// Port is the container port the server listens on.
+	Port int
+
+	// Connections counts the browsers connected to the server and not closed
+	// yet. Idle is set when there are none and the server waits for the idle
+	// timeout, see WithIdleTimeout.
+	Connections int
+	Idle        bool
+
+	// Restarts counts the relaunches of the server, see WithMaxRestarts.
+	Restarts int
+}
+
+// CurrentStatus returns what the default session runs.
+func CurrentStatus() (Status, error) {
+	s, err := defaultSession()
+	if err != nil {
+		return Status{}, err
+	}
+	return s.Status()
+}
+
+// Status returns what the session runs.
+func (s *Session) Status() (Status, error) {
+	c := s.running()
+	if c == nil {
+		return Status{}, fmt.Errorf("container is not running")
+	}
+
+	ctx, cancel := context.WithTimeout(c.context, 10*time.Second)
+	defer cancel()
+
+	inspect, err := c.browsers.Inspect(ctx)
+	if err != nil {
+		return Status{}, fmt.Errorf("could not inspect browser container: %w", err)
+	}
+
+	status := c.status(s.config)
+	status.ContainerID = c.browsers.GetContainerID()
+	status.ImageDigest = inspect.Image
+
+	// The image ID still identifies the image when its digest is unknown.
+	if digest, err := c.imageDigest(ctx, inspect.Image, s.config.repository); err != nil {
+		s.logger().Warn("could not get image digest, reporting its ID", "error", err)
+	} else if digest != "" {
+		status.ImageDigest = digest
+	}
+
+	for port, bindings := range inspect.NetworkSettings.Ports {
+		if len(bindings) == 0 {
+			continue
+		}
+		// Docker binds IPv4 and IPv6 to the same host port.
+		hostPort, err := strconv.Atoi(bindings[0].HostPort)
+		if err != nil {
+			continue
+		}
+		status.Ports[int(port.Num())] = hostPort
+	}
+
+	s.mutexBrowser.Lock()
+	defer s.mutexBrowser.Unlock()
+
+	connections := map[*browser]int{}
+	for _, c := range s.connections {
+		connections[c.server]++
+	}
+	for _, b := range s.servers {
+		if !b.running() {
+			continue
+		}
+		status.Browsers = append(status.Browsers, BrowserStatus{
+			Name:        b.instanceOf,
+			Key:         b.key,
+			Port:        b.instancePort,
+			Connections: connections[b],
+			Idle:        b.idle != nil,
+			Restarts:    b.restarts,
+		})
+	}
+	slices.SortFunc(status.Browsers, func(a, b BrowserStatus) int {
+		if a.Name != b.Name {
+			return strings.Compare(a.Name, b.Name)
+		}
+		return a.Port - b.Port
+	})
+
+	return status, nil
+}
+
+// status returns what the container runs as far as it knows, without asking
+// Docker.
+func (c *container) status(cfg *config) Status {
+	return Status{
+		Shared:    c.shared,
+		Image:     c.image,
+		Tag:       cfg.tag,
+		TagSource: cfg.tagSource,
+		// The address of the proxy has its port already.
+		Proxy: c.proxy,
+		Ports: map[int]int{},
+	}
+}
+
+// imageDigest returns the digest of image in repository, see repoDigest. The
+// container runs the same image all along, so Docker is only asked until it
+// answered.
+func (c *container) imageDigest(ctx context.Context, image, repository string) (string, error) {
+	c.mutexDigest.Lock()
+	defer c.mutexDigest.Unlock()
+
+	if !c.digested {
+		digest, err := repoDigest(ctx, image, repository)
+		if err != nil {
+			return "", err
+		}
+		c.digest, c.digested = digest, true
+	}
+	return c.digest, nil
+}
+
+// repoDigest returns the digest of the image in repository, or "" when it was
+// not pulled from there.
+func repoDigest(ctx context.Context, image, repository string) (string, error) {
+	cli, err := testcontainers.NewDockerClientWithOpts(ctx)
+	if err != nil {
+		return "", fmt.Errorf("could not connect to docker: %w", err)
+	}
+	defer cli.Close()
+
+	inspect, err := cli.ImageInspect(ctx, image)
+	if err != nil {
+		return "", fmt.Errorf("could not inspect image %s: %w", image, err)
+	}
+	for _, digest := range inspect.RepoDigests {
+		if name, sum, ok := strings.Cut(digest, "@"); ok && name == repository {
+			return sum, nil
+		}
+	}
+	return "", nil
+}
+
+// String formats the status over several lines, for logging.
+func (s Status) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "container %s", s.ContainerID)
+	if s.Shared {
+		b.WriteString(" (shared)")
+	}
+	fmt.Fprintf(&b, "\nimage %s (%s)\n", s.Image, s.ImageDigest)
+	fmt.Fprintf(&b, "tag %s from %s\n", s.Tag, s.TagSource)
+	fmt.Fprintf(&b, "proxy %s\n", s.Proxy)
+
+	b.WriteString("ports")
+	for _, port := range slices.Sorted(maps.Keys(s.Ports)) {
+		fmt.Fprintf(&b, " %d->%d", port, s.Ports[port])
+	}
+	b.WriteString("\n")
+
+	fmt.Fprintf(&b, "%d browser servers", len(s.Browsers))
+	for _, browser := range s.Browsers {
+		fmt.Fprintf(&b, "\n\t%s on port %d: %d connections", browser.Key, browser.Port, browser.Connections)
+		if browser.Idle {
+			b.WriteString(", idle")
+		}
+		if browser.Restarts > 0 {
+			fmt.Fprintf(&b, ", %d restarts", browser.Restarts)
+		}
+	}
+	return b.String()
+}
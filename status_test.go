@@ -0,0 +1,52 @@
+package playwrightcigo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func Test_StatusString(t *testing.T) {
+	t.Parallel()
+
+	status := Status{
+		ContainerID: "0123abcd",
+		Shared:      true,
+		Image:       "ghcr.io/mountain-reverie/playwright-ci-go:v0.6100.1",
+		ImageDigest: "sha256:feed",
+		Tag:         "v0.6100.1",
+		TagSource:   TagFromBuildInfo,
+		Proxy:       "http://172.17.0.1:41234",
+		Ports:       map[int]int{1040: 32769, 1025: 32768},
+		Browsers: []BrowserStatus{
+			{Name: "chromium", Key: "chromium {}", Port: 1025, Connections: 2},
+			{Name: "firefox", Key: "firefox {}", Port: 1040, Idle: true, Restarts: 1},
+		},
+	}
+
+	assert.Equal(t, `container 0123abcd (shared)
+image ghcr.io/mountain-reverie/playwright-ci-go:v0.6100.1 (sha256:feed)
+tag v0.6100.1 from build info
+proxy http://172.17.0.1:41234
+ports 1025->32768 1040->32769
+2 browser servers
+	chromium {} on port 1025: 2 connections
+	firefox {} on port 1040: 0 connections, idle, 1 restarts`, status.String())
+}
+
+func Test_StatusConfig(t *testing.T) {
+	t.Parallel()
+
+	cfg := newConfig(WithRepository("", "v1.2.3"))
+	require.NoError(t, cfg.resolveTag())
+
+	c := &container{proxy: "http://" + testcontainers.HostInternal + ":41234", image: "playwright-ci-go:v1.2.3"}
+	status := c.status(cfg)
+
+	assert.Equal(t, "v1.2.3", status.Tag)
+	assert.Equal(t, TagFromOption, status.TagSource)
+	assert.Equal(t, "playwright-ci-go:v1.2.3", status.Image)
+	assert.Equal(t, "http://"+testcontainers.HostInternal+":41234", status.Proxy)
+}
@@ -0,0 +1,157 @@
+package playwrightcigo
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mxschmitt/playwright-go"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+// Browser returns a browser of the given name ("chromium", "firefox" or
+// "webkit") from the default session, for use in a test or benchmark.
+//
+// Install is called on demand with the provided options, and cleanups are
+// registered on t to close the browser and call Uninstall once the test
+// completes, so there is nothing to tear down by hand.
+//
+// When no Docker (or compatible) container provider is reachable the test is
+// skipped, unless WithRequireDocker is given, in which case it fails. When the
+// test fails, the output of the browser server is logged to it.
+func Browser(t testing.TB, name string, opts ...Option) playwright.Browser {
+	t.Helper()
+
+	s := install(t, opts...)
+	b, err := s.LaunchContext(t.Context(), name)
+	if err != nil {
+		t.Fatalf("could not launch %s: %v", name, err)
+	}
+	t.Cleanup(func() {
+		if err := s.BrowserErr(b); err != nil {
+			t.Errorf("%s browser server died during the test: %v", name, err)
+		}
+		if t.Failed() {
+			t.Logf("%s browser server output:\n%s", name, s.BrowserOutput(b))
+		}
+		if err := b.Close(); err != nil {
+			t.Errorf("could not close %s: %v", name, err)
+		}
+	})
+
+	return b
+}
+
+// Serve serves handler to the browsers of the default session under a
+// hostname of its own, for use in a test or benchmark, and returns its base
+// URL, see Session.Serve. Install is called on demand with the provided
+// options, like with Browser, and handler is no longer served once the test
+// completes.
+func Serve(t testing.TB, handler http.Handler, opts ...Option) string {
+	t.Helper()
+
+	s := install(t, opts...)
+	baseURL, stop := s.serve(handler)
+	t.Cleanup(stop)
+	return baseURL
+}
+
+// install calls Install for a test, with a cleanup calling Uninstall, and
+// returns the default session. It skips or fails the test, see Browser, when
+// no container provider is reachable.
+func install(t testing.TB, opts ...Option) *Session {
+	t.Helper()
+
+	c := newConfig(opts...)
+	if err := providerHealth(c.ctx); err != nil {
+		if c.requireDocker {
+			t.Fatalf("playwright-ci-go: no container provider reachable: %v", err)
+		}
+		t.Skipf("playwright-ci-go: skipping, no container provider reachable: %v", err)
+	}
+
+	if err := Install(opts...); err != nil {
+		t.Fatalf("could not install playwright-ci-go: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := Uninstall(); err != nil {
+			t.Errorf("could not uninstall playwright-ci-go: %v", err)
+		}
+	})
+
+	s, err := defaultSession()
+	if err != nil {
+		t.Fatalf("could not get playwright-ci-go session: %v", err)
+	}
+	return s
+}
+
+// TestLogger returns a logger writing its records, debug ones included, with
+// tb.Log, so that they show up along with the test that caused them. Once the
+// test completed, records go to stderr instead.
+//
+//	session, err := playwrightcigo.New(playwrightcigo.WithLogger(playwrightcigo.TestLogger(t)))
+func TestLogger(tb testing.TB) *slog.Logger {
+	w := &testWriter{tb: tb}
+	tb.Cleanup(func() {
+		w.mutex.Lock()
+		defer w.mutex.Unlock()
+		w.done = true
+	})
+	return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			// The test log has its own timing.
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+}
+
+// testWriter writes the records of TestLogger, one per call. mutex keeps the
+// test from completing while a record is written to it, which would panic.
+type testWriter struct {
+	tb    testing.TB
+	mutex sync.Mutex
+	done  bool
+}
+
+func (w *testWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.done {
+		return os.Stderr.Write(p)
+	}
+	w.tb.Log(strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
+
+// providerHealth reports whether testcontainers can reach a container provider.
+func providerHealth(ctx context.Context) (err error) {
+	// testcontainers panics on some broken Docker setups instead of returning
+	// an error, which for our purpose means the same thing.
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("container provider panicked: %v", r)
+		}
+	}()
+
+	provider, err := testcontainers.ProviderDefault.GetProvider()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	return provider.Health(ctx)
+}
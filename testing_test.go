@@ -0,0 +1,41 @@
+package playwrightcigo
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// logTB records what is logged to it and the cleanups registered on it.
+type logTB struct {
+	testing.TB
+
+	logs     []string
+	cleanups []func()
+}
+
+func (tb *logTB) Log(args ...any) {
+	tb.logs = append(tb.logs, fmt.Sprint(args...))
+}
+
+func (tb *logTB) Cleanup(f func()) {
+	tb.cleanups = append(tb.cleanups, f)
+}
+
+func Test_TestLogger(t *testing.T) {
+	t.Parallel()
+
+	tb := &logTB{TB: t}
+	logger := TestLogger(tb).With("container_id", "0123abcd")
+
+	logger.Debug("launched browser server", "browser", "chromium", "attempt", 2)
+	assert.Equal(t, []string{`level=DEBUG msg="launched browser server" container_id=0123abcd browser=chromium attempt=2`}, tb.logs)
+
+	// Once the test completed, t.Log must not be called anymore.
+	for _, cleanup := range tb.cleanups {
+		cleanup()
+	}
+	logger.Warn("could not stop browser server")
+	assert.Len(t, tb.logs, 1)
+}